@@ -0,0 +1,276 @@
+package mvt
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Minimal Mapbox Vector Tile 2.1 encoder, see
+// https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+const DefaultExtent = 4096
+
+const (
+	geomPoint      = 1
+	geomLineString = 2
+	geomPolygon    = 3
+)
+
+const (
+	cmdMoveTo    = 1
+	cmdLineTo    = 2
+	cmdClosePath = 7
+)
+
+// Point is a position in tile coordinates, 0..extent across the tile.
+type Point struct {
+	X int
+	Y int
+}
+
+type Tile struct {
+	Layers []*Layer
+}
+
+type Layer struct {
+	Name     string
+	Extent   uint32
+	features []feature
+	keys     []string
+	keyIndex map[string]uint32
+	values   []interface{}
+	valIndex map[interface{}]uint32
+}
+
+type feature struct {
+	id       uint64
+	tags     []uint32
+	geomType uint64
+	geometry []uint32
+}
+
+func NewLayer(name string) *Layer {
+	return &Layer{
+		Name:     name,
+		Extent:   DefaultExtent,
+		keyIndex: make(map[string]uint32),
+		valIndex: make(map[interface{}]uint32),
+	}
+}
+
+// Len returns the number of features in the layer.
+func (l *Layer) Len() int {
+	return len(l.features)
+}
+
+// AddPoint adds a point feature.
+func (l *Layer) AddPoint(id uint64, p Point, properties map[string]interface{}) {
+	geometry := []uint32{command(cmdMoveTo, 1), zigzag(p.X), zigzag(p.Y)}
+	l.features = append(l.features, feature{id: id, tags: l.tags(properties), geomType: geomPoint, geometry: geometry})
+}
+
+// AddLineStrings adds a (multi) linestring feature. Lines with fewer than
+// two distinct points are dropped.
+func (l *Layer) AddLineStrings(id uint64, lines [][]Point, properties map[string]interface{}) {
+	var geometry []uint32
+	cursor := Point{}
+	for _, line := range lines {
+		line = dedupe(line)
+		if len(line) < 2 {
+			continue
+		}
+		geometry = append(geometry, command(cmdMoveTo, 1), zigzag(line[0].X-cursor.X), zigzag(line[0].Y-cursor.Y))
+		cursor = line[0]
+		geometry = append(geometry, command(cmdLineTo, len(line)-1))
+		for _, p := range line[1:] {
+			geometry = append(geometry, zigzag(p.X-cursor.X), zigzag(p.Y-cursor.Y))
+			cursor = p
+		}
+	}
+	if len(geometry) == 0 {
+		return
+	}
+	l.features = append(l.features, feature{id: id, tags: l.tags(properties), geomType: geomLineString, geometry: geometry})
+}
+
+// AddPolygon adds a polygon feature from one or more rings. Exterior rings
+// must be clockwise in tile coordinates, interior rings counter-clockwise.
+func (l *Layer) AddPolygon(id uint64, rings [][]Point, properties map[string]interface{}) {
+	var geometry []uint32
+	cursor := Point{}
+	for _, ring := range rings {
+		ring = dedupe(ring)
+		if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+			ring = ring[:len(ring)-1]
+		}
+		if len(ring) < 3 {
+			continue
+		}
+		geometry = append(geometry, command(cmdMoveTo, 1), zigzag(ring[0].X-cursor.X), zigzag(ring[0].Y-cursor.Y))
+		cursor = ring[0]
+		geometry = append(geometry, command(cmdLineTo, len(ring)-1))
+		for _, p := range ring[1:] {
+			geometry = append(geometry, zigzag(p.X-cursor.X), zigzag(p.Y-cursor.Y))
+			cursor = p
+		}
+		geometry = append(geometry, command(cmdClosePath, 1))
+	}
+	if len(geometry) == 0 {
+		return
+	}
+	l.features = append(l.features, feature{id: id, tags: l.tags(properties), geomType: geomPolygon, geometry: geometry})
+}
+
+func (l *Layer) tags(properties map[string]interface{}) []uint32 {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tags []uint32
+	for _, key := range keys {
+		value := normalizeValue(properties[key])
+		if value == nil {
+			continue
+		}
+		keyIdx, ok := l.keyIndex[key]
+		if !ok {
+			keyIdx = uint32(len(l.keys))
+			l.keys = append(l.keys, key)
+			l.keyIndex[key] = keyIdx
+		}
+		valIdx, ok := l.valIndex[value]
+		if !ok {
+			valIdx = uint32(len(l.values))
+			l.values = append(l.values, value)
+			l.valIndex[value] = valIdx
+		}
+		tags = append(tags, keyIdx, valIdx)
+	}
+	return tags
+}
+
+// normalizeValue narrows property values to the types a tile can hold.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, bool, float64, int64, uint64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint32:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	default:
+		return nil
+	}
+}
+
+// Marshal encodes the tile as protobuf.
+func (t *Tile) Marshal() []byte {
+	var out []byte
+	for _, layer := range t.Layers {
+		out = protowire.AppendTag(out, 3, protowire.BytesType)
+		out = protowire.AppendBytes(out, layer.marshal())
+	}
+	return out
+}
+
+func (l *Layer) marshal() []byte {
+	var out []byte
+	out = protowire.AppendTag(out, 15, protowire.VarintType)
+	out = protowire.AppendVarint(out, 2)
+	out = protowire.AppendTag(out, 1, protowire.BytesType)
+	out = protowire.AppendString(out, l.Name)
+
+	for _, f := range l.features {
+		out = protowire.AppendTag(out, 2, protowire.BytesType)
+		out = protowire.AppendBytes(out, f.marshal())
+	}
+	for _, key := range l.keys {
+		out = protowire.AppendTag(out, 3, protowire.BytesType)
+		out = protowire.AppendString(out, key)
+	}
+	for _, value := range l.values {
+		out = protowire.AppendTag(out, 4, protowire.BytesType)
+		out = protowire.AppendBytes(out, marshalValue(value))
+	}
+
+	out = protowire.AppendTag(out, 5, protowire.VarintType)
+	out = protowire.AppendVarint(out, uint64(l.Extent))
+	return out
+}
+
+func (f feature) marshal() []byte {
+	var out []byte
+	if f.id != 0 {
+		out = protowire.AppendTag(out, 1, protowire.VarintType)
+		out = protowire.AppendVarint(out, f.id)
+	}
+	if len(f.tags) > 0 {
+		out = protowire.AppendTag(out, 2, protowire.BytesType)
+		out = protowire.AppendBytes(out, packed(f.tags))
+	}
+	out = protowire.AppendTag(out, 3, protowire.VarintType)
+	out = protowire.AppendVarint(out, f.geomType)
+	out = protowire.AppendTag(out, 4, protowire.BytesType)
+	out = protowire.AppendBytes(out, packed(f.geometry))
+	return out
+}
+
+func marshalValue(value interface{}) []byte {
+	var out []byte
+	switch v := value.(type) {
+	case string:
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendString(out, v)
+	case float64:
+		out = protowire.AppendTag(out, 3, protowire.Fixed64Type)
+		out = protowire.AppendFixed64(out, math.Float64bits(v))
+	case int64:
+		out = protowire.AppendTag(out, 6, protowire.VarintType)
+		out = protowire.AppendVarint(out, protowire.EncodeZigZag(v))
+	case uint64:
+		out = protowire.AppendTag(out, 5, protowire.VarintType)
+		out = protowire.AppendVarint(out, v)
+	case bool:
+		out = protowire.AppendTag(out, 7, protowire.VarintType)
+		out = protowire.AppendVarint(out, protowire.EncodeBool(v))
+	}
+	return out
+}
+
+func packed(values []uint32) []byte {
+	var out []byte
+	for _, v := range values {
+		out = protowire.AppendVarint(out, uint64(v))
+	}
+	return out
+}
+
+func command(id, count int) uint32 {
+	return uint32((id & 0x7) | (count << 3))
+}
+
+func zigzag(n int) uint32 {
+	v := int32(n)
+	return uint32((v << 1) ^ (v >> 31))
+}
+
+func dedupe(line []Point) []Point {
+	if len(line) == 0 {
+		return line
+	}
+	out := []Point{line[0]}
+	for _, p := range line[1:] {
+		if p != out[len(out)-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
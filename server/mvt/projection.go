@@ -0,0 +1,35 @@
+package mvt
+
+import "math"
+
+// TileBounds returns the lat/lon bounding box of a z/x/y web mercator tile.
+func TileBounds(z, x, y int) (minLat, minLon, maxLat, maxLon float64) {
+	n := math.Exp2(float64(z))
+	minLon = float64(x)/n*360 - 180
+	maxLon = float64(x+1)/n*360 - 180
+	maxLat = tileLat(float64(y), n)
+	minLat = tileLat(float64(y+1), n)
+	return minLat, minLon, maxLat, maxLon
+}
+
+func tileLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+// Mercator projects lat/lon into world coordinates between 0 and 1, with y
+// growing southwards like tile rows.
+func Mercator(lat, lon float64) (float64, float64) {
+	x := (lon + 180) / 360
+	sin := math.Sin(lat * math.Pi / 180)
+	y := 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)
+	return x, y
+}
+
+// Project converts world coordinates into the tile coordinates of z/x/y.
+func Project(worldX, worldY float64, z, x, y int, extent uint32) Point {
+	n := math.Exp2(float64(z))
+	return Point{
+		X: int(math.Round((worldX*n - float64(x)) * float64(extent))),
+		Y: int(math.Round((worldY*n - float64(y)) * float64(extent))),
+	}
+}
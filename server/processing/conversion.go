@@ -15,6 +15,9 @@ var ShapeData []Shape
 var StopTimeData []StopTime
 var StopData []Stop
 var TripData []Trip
+var AgencyData []Agency
+var CalendarData []Calendar
+var CalendarDateData []CalendarDate
 
 func OpenFile(fileName string) ([][]string, error) {
 
@@ -57,16 +60,23 @@ func LoadTripData() bool {
 
 		var directionID int
 		fmt.Sscanf(row[4], "%d", &directionID)
-		blockID := strings.TrimSpace(row[5])
+		blockID := NormalizeBlockID(row[5])
+
+		// a missing wheelchair_accessible column means no information
+		wheelchairAccessible := 0
+		if len(row) > 7 && strings.TrimSpace(row[7]) != "" {
+			wheelchairAccessible, _ = strconv.Atoi(strings.TrimSpace(row[7]))
+		}
 
 		loadedTrips = append(loadedTrips, Trip{
-			RouteID:      row[0],
-			ServiceID:    row[1],
-			TripID:       row[2],
-			TripHeadsign: row[3],
-			DirectionID:  directionID,
-			BlockID:      blockID,
-			ShapeID:      row[6],
+			RouteID:              row[0],
+			ServiceID:            row[1],
+			TripID:               row[2],
+			TripHeadsign:         row[3],
+			DirectionID:          directionID,
+			BlockID:              blockID,
+			ShapeID:              row[6],
+			WheelchairAccessible: wheelchairAccessible,
 		})
 	}
 
@@ -177,14 +187,28 @@ func LoadStopTimeData() bool {
 		pickupType, _ := strconv.Atoi(row[6])
 		dropOffType, _ := strconv.Atoi(row[7])
 
+		shapeDistTraveled := 0.0
+		if len(row) > 8 && strings.TrimSpace(row[8]) != "" {
+			shapeDistTraveled, _ = strconv.ParseFloat(strings.TrimSpace(row[8]), 64)
+		}
+
+		// an empty or missing timepoint means the times are exact
+		timepoint := 1
+		if len(row) > 9 && strings.TrimSpace(row[9]) != "" {
+			timepoint, _ = strconv.Atoi(strings.TrimSpace(row[9]))
+		}
+
 		loadedStopTimes = append(loadedStopTimes, StopTime{
-			TripID:        row[0],
-			ArrivalTime:   row[1],
-			DepartureTime: row[2],
-			StopID:        row[3],
-			StopSequence:  stopSequence,
-			PickupType:    pickupType,
-			DropOffType:   dropOffType,
+			TripID:            row[0],
+			ArrivalTime:       row[1],
+			DepartureTime:     row[2],
+			StopID:            row[3],
+			StopSequence:      stopSequence,
+			StopHeadsign:      row[5],
+			PickupType:        pickupType,
+			DropOffType:       dropOffType,
+			ShapeDistTraveled: shapeDistTraveled,
+			Timepoint:         timepoint,
 		})
 	}
 
@@ -211,14 +235,24 @@ func LoadStopData() bool {
 		lat, _ := strconv.ParseFloat(row[4], 64)
 		lon, _ := strconv.ParseFloat(row[5], 64)
 
-		loadedStops = append(loadedStops, Stop{
+		stop := Stop{
 			StopID:   row[0],
 			StopCode: row[1],
 			StopName: row[2],
 			StopDesc: row[3],
 			StopLat:  lat,
 			StopLon:  lon,
-		})
+		}
+		if len(row) > 11 {
+			stop.ZoneID = row[6]
+			stop.StopURL = row[7]
+			stop.LocationType, _ = strconv.Atoi(strings.TrimSpace(row[8]))
+			stop.ParentStation = row[9]
+			stop.StopTimezone = row[10]
+			stop.WheelchairBoarding, _ = strconv.Atoi(strings.TrimSpace(row[11]))
+		}
+
+		loadedStops = append(loadedStops, stop)
 	}
 
 	StopData = loadedStops
@@ -226,3 +260,116 @@ func LoadStopData() bool {
 	fmt.Printf("Successfully loaded %d stops into memory.\n", len(StopData))
 	return true
 }
+
+// NormalizeBlockID collapses the fixed-width padding RTD uses in block_id
+// ("   0  7") into a URL friendly form ("0-7").
+func NormalizeBlockID(raw string) string {
+	return strings.Join(strings.Fields(raw), "-")
+}
+
+func LoadAgencyData() bool {
+	records, err := OpenFile("agency.txt")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return false
+	}
+
+	var loadedAgencies []Agency
+
+	for i, row := range records {
+		if i == 0 {
+			continue
+		}
+
+		loadedAgencies = append(loadedAgencies, Agency{
+			AgencyID:       row[0],
+			AgencyName:     row[1],
+			AgencyURL:      row[2],
+			AgencyTimezone: row[3],
+			AgencyLang:     row[4],
+		})
+	}
+
+	AgencyData = loadedAgencies
+
+	fmt.Printf("Successfully loaded %d agencies into memory.\n", len(AgencyData))
+	return true
+}
+
+func LoadCalendarData() bool {
+	records, err := OpenFile("calendar.txt")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return false
+	}
+
+	var loadedCalendars []Calendar
+
+	for i, row := range records {
+		if i == 0 {
+			continue
+		}
+
+		// calendar.txt lists monday..sunday, time.Weekday starts on Sunday
+		var weekdays [7]bool
+		for day := 0; day < 7; day++ {
+			weekdays[(day+1)%7] = strings.TrimSpace(row[day+1]) == "1"
+		}
+
+		loadedCalendars = append(loadedCalendars, Calendar{
+			ServiceID: row[0],
+			Weekdays:  weekdays,
+			StartDate: strings.TrimSpace(row[8]),
+			EndDate:   strings.TrimSpace(row[9]),
+		})
+	}
+
+	CalendarData = loadedCalendars
+
+	fmt.Printf("Successfully loaded %d calendars into memory.\n", len(CalendarData))
+	return true
+}
+
+func LoadCalendarDateData() bool {
+	records, err := OpenFile("calendar_dates.txt")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return false
+	}
+
+	var loadedCalendarDates []CalendarDate
+
+	for i, row := range records {
+		if i == 0 {
+			continue
+		}
+
+		exceptionType, _ := strconv.Atoi(strings.TrimSpace(row[2]))
+
+		loadedCalendarDates = append(loadedCalendarDates, CalendarDate{
+			ServiceID:     row[0],
+			Date:          strings.TrimSpace(row[1]),
+			ExceptionType: exceptionType,
+		})
+	}
+
+	CalendarDateData = loadedCalendarDates
+
+	fmt.Printf("Successfully loaded %d calendar dates into memory.\n", len(CalendarDateData))
+	return true
+}
+
+// ParseGTFSTime converts an HH:MM:SS stop time into seconds after the start
+// of the service day. Hours may exceed 23 for trips running past midnight.
+func ParseGTFSTime(value string) (int, error) {
+	var h, m, s int
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d:%d:%d", &h, &m, &s); err != nil {
+		return 0, fmt.Errorf("invalid GTFS time %q: %w", value, err)
+	}
+	return h*3600 + m*60 + s, nil
+}
+
+// FormatGTFSTime is the inverse of ParseGTFSTime.
+func FormatGTFSTime(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, (seconds%3600)/60, seconds%60)
+}
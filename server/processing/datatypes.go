@@ -1,13 +1,14 @@
 package processing
 
 type Trip struct {
-	RouteID      string `json:"route_id"`
-	ServiceID    string `json:"service_id"`
-	TripID       string `json:"trip_id"`
-	TripHeadsign string `json:"trip_headsign"`
-	DirectionID  int    `json:"direction_id"`
-	BlockID      string `json:"block_id"`
-	ShapeID      string `json:"shape_id"`
+	RouteID              string `json:"route_id"`
+	ServiceID            string `json:"service_id"`
+	TripID               string `json:"trip_id"`
+	TripHeadsign         string `json:"trip_headsign"`
+	DirectionID          int    `json:"direction_id"`
+	BlockID              string `json:"block_id"`
+	ShapeID              string `json:"shape_id"`
+	WheelchairAccessible int    `json:"wheelchair_accessible"` // 0 unknown, 1 accessible, 2 not accessible
 }
 
 type Route struct {
@@ -55,7 +56,7 @@ type Stop struct {
 	LocationType       int     `json:"location_type"`
 	ParentStation      string  `json:"parent_station"`
 	StopTimezone       string  `json:"stop_timezone"`
-	WheelchairBoarding int     `json:"wheelchair_boarding"`
+	WheelchairBoarding int     `json:"wheelchair_boarding"` // 0 unknown or inherited from the parent station, 1 accessible, 2 not accessible
 }
 
 type AlertEntity struct {
@@ -94,8 +95,9 @@ type Translation struct {
 }
 
 type TripUpdateEntity struct {
-	ID         string     `json:"id"`
-	TripUpdate TripUpdate `json:"trip_update"`
+	ID         string      `json:"id"`
+	TripUpdate TripUpdate  `json:"trip_update"`
+	Enrichment *Enrichment `json:"enrichment,omitempty"` // only with ?enrich=true
 }
 
 type TripUpdate struct {
@@ -123,6 +125,7 @@ type StopTimeUpdate struct {
 	Arrival              StopTimeEvent `json:"arrival"`
 	Departure            StopTimeEvent `json:"departure"`
 	ScheduleRelationship int           `json:"schedule_relationship"`
+	StopName             string        `json:"stop_name,omitempty"` // only with ?enrich=true
 }
 
 type StopTimeEvent struct {
@@ -130,8 +133,30 @@ type StopTimeEvent struct {
 }
 
 type VehiclePositionEntity struct {
-	ID      string          `json:"id"`
-	Vehicle VehiclePosition `json:"vehicle"`
+	ID         string          `json:"id"`
+	Vehicle    VehiclePosition `json:"vehicle"`
+	Enrichment *Enrichment     `json:"enrichment,omitempty"` // only with ?enrich=true
+}
+
+// Enrichment inlines the static data a client would otherwise look up for
+// a realtime entity's trip.
+type Enrichment struct {
+	RouteShortName string        `json:"route_short_name"`
+	RouteLongName  string        `json:"route_long_name"`
+	RouteColor     string        `json:"route_color"`
+	RouteTextColor string        `json:"route_text_color"`
+	Headsign       string        `json:"headsign"`
+	ShapeID        string        `json:"shape_id"`
+	CurrentStop    *EnrichedStop `json:"current_stop,omitempty"`
+	NextStop       *EnrichedStop `json:"next_stop,omitempty"`
+}
+
+type EnrichedStop struct {
+	StopID           string `json:"stop_id"`
+	StopName         string `json:"stop_name"`
+	StopSequence     int    `json:"stop_sequence"`
+	ScheduledArrival string `json:"scheduled_arrival"`        // GTFS HH:MM:SS on the service date
+	ScheduledTime    int64  `json:"scheduled_time,omitempty"` // unix seconds, when the service date is known
 }
 
 type VehiclePosition struct {
@@ -149,3 +174,323 @@ type GeoPosition struct {
 	Longitude float64 `json:"longitude"`
 	Bearing   float64 `json:"bearing"`
 }
+
+type Agency struct {
+	AgencyID       string `json:"agency_id"`
+	AgencyName     string `json:"agency_name"`
+	AgencyURL      string `json:"agency_url"`
+	AgencyTimezone string `json:"agency_timezone"`
+	AgencyLang     string `json:"agency_lang"`
+}
+
+type Calendar struct {
+	ServiceID string  `json:"service_id"`
+	Weekdays  [7]bool `json:"weekdays"` // indexed by time.Weekday, Sunday first
+	StartDate string  `json:"start_date"`
+	EndDate   string  `json:"end_date"`
+}
+
+type CalendarDate struct {
+	ServiceID     string `json:"service_id"`
+	Date          string `json:"date"`
+	ExceptionType int    `json:"exception_type"` // 1=Added, 2=Removed
+}
+
+type Block struct {
+	BlockID     string      `json:"block_id"`
+	ServiceDate string      `json:"service_date"`
+	Trips       []BlockTrip `json:"trips"`
+	RouteIDs    []string    `json:"route_ids"`
+	Interlined  bool        `json:"interlined"`
+}
+
+type BlockTrip struct {
+	TripID          string `json:"trip_id"`
+	RouteID         string `json:"route_id"`
+	ServiceID       string `json:"service_id"`
+	TripHeadsign    string `json:"trip_headsign"`
+	DirectionID     int    `json:"direction_id"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	StartStopID     string `json:"start_stop_id"`
+	StartStopName   string `json:"start_stop_name"`
+	EndStopID       string `json:"end_stop_id"`
+	EndStopName     string `json:"end_stop_name"`
+	Interlined      bool   `json:"interlined"` // route differs from the previous trip in the block
+	PreviousRouteID string `json:"previous_route_id,omitempty"`
+}
+
+type TimeBand struct {
+	Name  string `json:"name"`
+	Start string `json:"start"` // HH:MM:SS, may exceed 24:00:00
+	End   string `json:"end"`
+}
+
+type HeadwayStat struct {
+	RouteID       string  `json:"route_id"`
+	DirectionID   int     `json:"direction_id"`
+	StopID        string  `json:"stop_id"`
+	StopName      string  `json:"stop_name"`
+	Band          string  `json:"band"`
+	Departures    int     `json:"departures"`
+	MinHeadway    float64 `json:"min_headway_minutes"`
+	MaxHeadway    float64 `json:"max_headway_minutes"`
+	MeanHeadway   float64 `json:"mean_headway_minutes"`
+	MedianHeadway float64 `json:"median_headway_minutes"`
+}
+
+type Timetable struct {
+	RouteID        string          `json:"route_id"`
+	RouteShortName string          `json:"route_short_name"`
+	RouteLongName  string          `json:"route_long_name"`
+	DirectionID    int             `json:"direction_id"`
+	ServiceDate    string          `json:"service_date"`
+	Stops          []TimetableStop `json:"stops"`
+	Trips          []TimetableRow  `json:"trips"`
+}
+
+type TimetableStop struct {
+	StopID   string `json:"stop_id"`
+	StopName string `json:"stop_name"`
+}
+
+type TimetableRow struct {
+	TripID       string   `json:"trip_id"`
+	TripHeadsign string   `json:"trip_headsign"`
+	Times        []string `json:"times"` // departure per column in Stops, empty when not served
+}
+
+type StopPattern struct {
+	PatternID   string        `json:"pattern_id"`
+	RouteID     string        `json:"route_id"`
+	DirectionID int           `json:"direction_id"`
+	TripCount   int           `json:"trip_count"`
+	Headsigns   []string      `json:"headsigns"`
+	ShapeID     string        `json:"shape_id"` // most common shape among the pattern's trips
+	Stops       []PatternStop `json:"stops"`
+	Shape       []Shape       `json:"shape,omitempty"`
+}
+
+type PatternStop struct {
+	StopID   string  `json:"stop_id"`
+	StopName string  `json:"stop_name"`
+	StopLat  float64 `json:"stop_lat"`
+	StopLon  float64 `json:"stop_lon"`
+}
+
+type RouteDirectionStops struct {
+	RouteID     string        `json:"route_id"`
+	DirectionID int           `json:"direction_id"`
+	Headsigns   []string      `json:"headsigns"`
+	Stops       []PatternStop `json:"stops"`
+}
+
+type StopRoute struct {
+	RouteID        string   `json:"route_id"`
+	RouteShortName string   `json:"route_short_name"`
+	RouteLongName  string   `json:"route_long_name"`
+	RouteColor     string   `json:"route_color"`
+	RouteTextColor string   `json:"route_text_color"`
+	DirectionID    int      `json:"direction_id"`
+	Headsigns      []string `json:"headsigns"`
+}
+
+type Departure struct {
+	TripID             string `json:"trip_id"`
+	RouteID            string `json:"route_id"`
+	RouteShortName     string `json:"route_short_name"`
+	RouteColor         string `json:"route_color"`
+	Headsign           string `json:"headsign"`
+	DirectionID        int    `json:"direction_id"`
+	StopID             string `json:"stop_id"`
+	StopSequence       int    `json:"stop_sequence"`
+	ServiceDate        string `json:"service_date"`
+	ScheduledDeparture string `json:"scheduled_departure"` // GTFS HH:MM:SS on the service date
+	ScheduledTime      int64  `json:"scheduled_time"`      // unix seconds
+	PredictedTime      int64  `json:"predicted_time,omitempty"`
+	Delay              int64  `json:"delay"` // seconds, positive when late
+	Realtime           bool   `json:"realtime"`
+	Canceled           bool   `json:"canceled"`
+	Skipped            bool   `json:"skipped"`
+	VehicleID          string `json:"vehicle_id,omitempty"`
+	Accessibility      string `json:"wheelchair_accessibility"` // accessible, inaccessible or unknown
+}
+
+type TripPrediction struct {
+	TripID            string              `json:"trip_id"`
+	RouteID           string              `json:"route_id"`
+	ServiceDate       string              `json:"service_date"`
+	VehicleID         string              `json:"vehicle_id,omitempty"`
+	Realtime          bool                `json:"realtime"` // a TripUpdate was applied
+	RealtimeAvailable bool                `json:"realtime_available"`
+	Canceled          bool                `json:"canceled"`
+	Timestamp         int64               `json:"timestamp,omitempty"` // of the TripUpdate, unix seconds
+	StopTimes         []PredictedStopTime `json:"stop_times"`
+}
+
+type PredictedStopTime struct {
+	StopID                 string `json:"stop_id"`
+	StopName               string `json:"stop_name"`
+	StopSequence           int    `json:"stop_sequence"`
+	ScheduledArrival       string `json:"scheduled_arrival"` // GTFS HH:MM:SS on the service date
+	ScheduledDeparture     string `json:"scheduled_departure"`
+	ScheduledArrivalTime   int64  `json:"scheduled_arrival_time"` // unix seconds
+	ScheduledDepartureTime int64  `json:"scheduled_departure_time"`
+	PredictedArrivalTime   int64  `json:"predicted_arrival_time,omitempty"`
+	PredictedDepartureTime int64  `json:"predicted_departure_time,omitempty"`
+	ArrivalDelay           int64  `json:"arrival_delay"` // seconds, positive when late
+	DepartureDelay         int64  `json:"departure_delay"`
+	Realtime               bool   `json:"realtime"` // predicted from an update at or before this stop
+	Updated                bool   `json:"updated"`  // the update was for this stop rather than carried from an earlier one
+	Skipped                bool   `json:"skipped"`
+}
+
+type TrackPoint struct {
+	VehicleID     string  `json:"vehicle_id"`
+	TripID        string  `json:"trip_id,omitempty"`
+	RouteID       string  `json:"route_id,omitempty"`
+	Timestamp     int64   `json:"timestamp"` // unix seconds
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	Bearing       float64 `json:"bearing"`
+	Speed         float64 `json:"speed"` // meters per second
+	StopID        string  `json:"stop_id,omitempty"`
+	CurrentStatus int     `json:"current_status"`
+}
+
+type VehicleTrack struct {
+	VehicleID string       `json:"vehicle_id,omitempty"`
+	TripID    string       `json:"trip_id,omitempty"`
+	From      int64        `json:"from"` // unix seconds
+	To        int64        `json:"to"`
+	Points    []TrackPoint `json:"points"` // oldest first
+}
+
+type ReplayStatus struct {
+	Replaying bool    `json:"replaying"`
+	Recording bool    `json:"recording"`
+	Now       int64   `json:"now"` // the server's clock, virtual when replaying, unix seconds
+	Speed     float64 `json:"speed"`
+	Paused    bool    `json:"paused"`
+	Start     int64   `json:"start,omitempty"` // first and last recording being replayed
+	End       int64   `json:"end,omitempty"`
+}
+
+type ValidationReport struct {
+	Feed          string            `json:"feed"`
+	CheckedAt     int64             `json:"checked_at"`     // unix seconds
+	FeedTimestamp int64             `json:"feed_timestamp"` // header timestamp, unix seconds
+	Entities      int               `json:"entities"`
+	Errors        int               `json:"errors"`
+	Warnings      int               `json:"warnings"`
+	Issues        []ValidationIssue `json:"issues"`
+}
+
+type ValidationIssue struct {
+	Rule        string              `json:"rule"`
+	Severity    string              `json:"severity"` // error or warning
+	Description string              `json:"description"`
+	Count       int                 `json:"count"`
+	Examples    []ValidationExample `json:"examples"`
+}
+
+type ValidationExample struct {
+	EntityID  string `json:"entity_id,omitempty"`
+	TripID    string `json:"trip_id,omitempty"`
+	RouteID   string `json:"route_id,omitempty"`
+	VehicleID string `json:"vehicle_id,omitempty"`
+	StopID    string `json:"stop_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+type NearbyStop struct {
+	Stop
+	Distance      float64 `json:"distance_meters"`
+	Accessibility string  `json:"wheelchair_accessibility"` // accessible, inaccessible or unknown
+}
+
+type Transfer struct {
+	FromStopID  string  `json:"from_stop_id"`
+	ToStopID    string  `json:"to_stop_id"`
+	ToStopName  string  `json:"to_stop_name"`
+	Distance    float64 `json:"distance_meters"` // straight line
+	WalkingTime int     `json:"walking_time"`    // seconds
+	Estimated   bool    `json:"estimated"`       // from speed and circuity rather than a walking time provider
+}
+
+type ReachableStop struct {
+	Stop
+	ArrivalTime int64 `json:"arrival_time"` // unix seconds
+	TravelTime  int64 `json:"travel_time"`  // seconds since leaving the origin
+	Transfers   int   `json:"transfers"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type"` // always "FeatureCollection"
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"` // always "Feature"
+	ID         string                 `json:"id,omitempty"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"` // [lon, lat] positions nested per geometry type
+}
+
+type SearchResult struct {
+	Type        string   `json:"type"` // stop, route or headsign
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Score       float64  `json:"score"`
+	StopLat     float64  `json:"stop_lat,omitempty"`
+	StopLon     float64  `json:"stop_lon,omitempty"`
+	RouteColor  string   `json:"route_color,omitempty"`
+	RouteIDs    []string `json:"route_ids,omitempty"`
+}
+
+type Itinerary struct {
+	DepartureTime  int64  `json:"departure_time"` // unix seconds
+	ArrivalTime    int64  `json:"arrival_time"`
+	Duration       int64  `json:"duration"` // seconds
+	Transfers      int    `json:"transfers"`
+	WalkingSeconds int64  `json:"walking_seconds"`
+	Realtime       bool   `json:"realtime"`                 // at least one leg uses predicted times
+	AtRisk         bool   `json:"at_risk"`                  // a transfer has less slack than is safe
+	Accessibility  string `json:"wheelchair_accessibility"` // accessible only if every stop and trip used is
+	Legs           []Leg  `json:"legs"`
+}
+
+type Leg struct {
+	Mode              string  `json:"mode"` // WALK or TRANSIT
+	From              Place   `json:"from"`
+	To                Place   `json:"to"`
+	StartTime         int64   `json:"start_time"`
+	EndTime           int64   `json:"end_time"`
+	Distance          float64 `json:"distance_meters,omitempty"`
+	RouteID           string  `json:"route_id,omitempty"`
+	RouteShortName    string  `json:"route_short_name,omitempty"`
+	RouteColor        string  `json:"route_color,omitempty"`
+	TripID            string  `json:"trip_id,omitempty"`
+	Headsign          string  `json:"headsign,omitempty"`
+	ServiceDate       string  `json:"service_date,omitempty"`
+	IntermediateStops []Place `json:"intermediate_stops,omitempty"`
+	Realtime          bool    `json:"realtime,omitempty"`
+	Delay             int64   `json:"delay,omitempty"`          // seconds late at the boarding stop
+	TransferSlack     *int64  `json:"transfer_slack,omitempty"` // seconds to spare before boarding after a previous ride
+	TransferAtRisk    bool    `json:"transfer_at_risk,omitempty"`
+	Accessibility     string  `json:"wheelchair_accessibility,omitempty"` // of the trip, for TRANSIT legs
+}
+
+type Place struct {
+	StopID        string  `json:"stop_id,omitempty"`
+	Name          string  `json:"name"`
+	Lat           float64 `json:"lat"`
+	Lon           float64 `json:"lon"`
+	Accessibility string  `json:"wheelchair_accessibility,omitempty"` // of the stop
+}
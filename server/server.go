@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-octo-eureka/server/email"
 	"go-octo-eureka/server/mapping"
@@ -8,13 +10,21 @@ import (
 	"go-octo-eureka/server/transport"
 	"go-octo-eureka/server/wsservice"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout bounds how long requests still running at shutdown may
+// take to finish.
+const shutdownTimeout = 10 * time.Second
+
 func ServeGin() {
 
 	port := os.Getenv("GIN_PORT")
@@ -23,7 +33,7 @@ func ServeGin() {
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(5)
+	wg.Add(6)
 
 	go func() {
 		fmt.Println("Starting GenerateTripData...")
@@ -71,14 +81,71 @@ func ServeGin() {
 		if haveData {
 			fmt.Println("Initializing Stops Map...")
 			transport.InitStopsMap()
+			transport.InitStopsIndex()
 		}
 		fmt.Println("Finished GenerateStopsData")
 		wg.Done()
 	}()
+	go func() {
+		fmt.Println("Starting GenerateCalendarData...")
+		haveAgency := processing.LoadAgencyData()
+		if haveAgency {
+			fmt.Println("Initializing Agency...")
+			transport.InitAgency()
+		}
+		haveCalendar := processing.LoadCalendarData()
+		haveCalendarDates := processing.LoadCalendarDateData()
+		if haveCalendar || haveCalendarDates {
+			fmt.Println("Initializing Calendar Maps...")
+			transport.InitCalendarMaps()
+		}
+		fmt.Println("Finished GenerateCalendarData")
+		wg.Done()
+	}()
 
 	wg.Wait()
 	fmt.Println("All processing tasks completed.")
 
+	fmt.Println("Deriving Stop Patterns...")
+	transport.InitPatterns()
+
+	fmt.Println("Indexing Route and Stop Relationships...")
+	transport.InitRelationships()
+
+	fmt.Println("Preparing Vector Tiles...")
+	transport.InitVectorTiles()
+
+	fmt.Println("Building Search Index...")
+	transport.InitSearchIndex()
+
+	fmt.Println("Generating Walking Transfers...")
+	transport.LoadWalkingConfig()
+	transport.InitTransfers()
+
+	fmt.Println("Preparing Journey Planner...")
+	transport.InitPlanner()
+
+	// push every new vehicle feed to the WebSocket subscribers
+	transport.OnVehiclePositions = func(timestamp int64, vehicles []processing.VehiclePositionEntity) {
+		byRoute := make(map[string][]interface{})
+		for _, v := range vehicles {
+			byRoute[v.Vehicle.Trip.RouteID] = append(byRoute[v.Vehicle.Trip.RouteID], v)
+		}
+		wsservice.PublishVehicles(timestamp, byRoute)
+	}
+
+	fmt.Println("Starting Realtime Pollers...")
+	if err := transport.LoadRealtimeSources(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := transport.LoadReplay(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := transport.LoadVehicleHistory(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	transport.StartRealtimePollers()
+
 	resendClient, resendError := email.InitResendClient()
 	if resendError != nil {
 		log.Fatalf("Error: %v", resendError)
@@ -98,6 +165,7 @@ func ServeGin() {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.ExposeHeaders = []string{"X-Feed-Age", "X-Feed-Timestamp", "X-Feed-Missing"}
 	r.Use(cors.New(config))
 
 	wsservice.Init()
@@ -114,7 +182,27 @@ func ServeGin() {
 
 	transport.AddGTFSRoutes(r)
 
+	srv := &http.Server{Addr: fmt.Sprintf(":%s", port), Handler: r}
+
+	// on a signal stop taking requests and let the running ones finish,
+	// then flush the persisted vehicle history before going down
+	stopped := make(chan struct{})
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+		close(stopped)
+	}()
+
 	log.Printf("Serving Gin at :%s", port)
-	srv := fmt.Sprintf(":%s", port)
-	r.Run(srv)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Error: %v", err)
+	}
+	<-stopped
+	transport.CloseVehicleHistory()
 }
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"strconv"
+)
+
+// GTFS encodes stop wheelchair_boarding and trip wheelchair_accessible the
+// same way: 0 or empty for no information, 1 accessible, 2 not accessible.
+const (
+	wheelchairUnknown      = 0
+	wheelchairAccessible   = 1
+	wheelchairInaccessible = 2
+)
+
+type wheelchairFilter int
+
+const (
+	wheelchairAny          wheelchairFilter = iota // no filtering
+	wheelchairRequired                             // only stops and trips known to be accessible
+	wheelchairAllowUnknown                         // exclude only those known not to be accessible
+)
+
+// parseWheelchairFilter reads ?wheelchair=true and ?include_unknown=true.
+func parseWheelchairFilter(wheelchair, includeUnknown string) (wheelchairFilter, error) {
+	if wheelchair == "" {
+		return wheelchairAny, nil
+	}
+	required, err := strconv.ParseBool(wheelchair)
+	if err != nil {
+		return wheelchairAny, fmt.Errorf("wheelchair must be true or false")
+	}
+	if !required {
+		return wheelchairAny, nil
+	}
+	if includeUnknown == "" {
+		return wheelchairRequired, nil
+	}
+	lenient, err := strconv.ParseBool(includeUnknown)
+	if err != nil {
+		return wheelchairAny, fmt.Errorf("include_unknown must be true or false")
+	}
+	if lenient {
+		return wheelchairAllowUnknown, nil
+	}
+	return wheelchairRequired, nil
+}
+
+func (f wheelchairFilter) allows(value int) bool {
+	switch f {
+	case wheelchairRequired:
+		return value == wheelchairAccessible
+	case wheelchairAllowUnknown:
+		return value != wheelchairInaccessible
+	default:
+		return true
+	}
+}
+
+// wheelchairLabel spells out an accessibility value so that missing data is
+// reported as "unknown" rather than as a bare zero.
+func wheelchairLabel(value int) string {
+	switch value {
+	case wheelchairAccessible:
+		return "accessible"
+	case wheelchairInaccessible:
+		return "inaccessible"
+	default:
+		return "unknown"
+	}
+}
+
+// stopWheelchairBoarding resolves a stop's accessibility, inheriting from
+// its parent station when the stop itself has no information.
+func stopWheelchairBoarding(stop processing.Stop) int {
+	if stop.WheelchairBoarding == wheelchairUnknown && stop.ParentStation != "" {
+		if parent, ok := findStopById(stop.ParentStation); ok {
+			return parent.WheelchairBoarding
+		}
+	}
+	return stop.WheelchairBoarding
+}
+
+// combineWheelchair summarises several values: inaccessible if any part is,
+// accessible only if every part is known to be.
+func combineWheelchair(values ...int) int {
+	combined := wheelchairAccessible
+	for _, value := range values {
+		switch value {
+		case wheelchairInaccessible:
+			return wheelchairInaccessible
+		case wheelchairAccessible:
+		default:
+			combined = wheelchairUnknown
+		}
+	}
+	return combined
+}
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"sort"
+	"strings"
+	"time"
+)
+
+var DefaultTimeBands = []processing.TimeBand{
+	{Name: "early", Start: "00:00:00", End: "06:00:00"},
+	{Name: "am_peak", Start: "06:00:00", End: "09:00:00"},
+	{Name: "midday", Start: "09:00:00", End: "15:00:00"},
+	{Name: "pm_peak", Start: "15:00:00", End: "18:00:00"},
+	{Name: "evening", Start: "18:00:00", End: "22:00:00"},
+	{Name: "night", Start: "22:00:00", End: "30:00:00"},
+}
+
+// parseTimeBands reads bands formatted as name=HH:MM-HH:MM separated by
+// commas, e.g. "am_peak=06:00-09:00,midday=09:00-15:00". Names must be
+// present and unique since they label the results.
+func parseTimeBands(value string) ([]processing.TimeBand, error) {
+	if value == "" {
+		return DefaultTimeBands, nil
+	}
+
+	var bands []processing.TimeBand
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		name, span, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("time band %q must be formatted as name=HH:MM-HH:MM", part)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("time band %q has no name", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("time band %q is given more than once", name)
+		}
+		seen[name] = true
+		start, end, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("time band %q must be formatted as name=HH:MM-HH:MM", part)
+		}
+		band := processing.TimeBand{Name: name, Start: padClock(start), End: padClock(end)}
+		startSec, err := processing.ParseGTFSTime(band.Start)
+		if err != nil {
+			return nil, err
+		}
+		endSec, err := processing.ParseGTFSTime(band.End)
+		if err != nil {
+			return nil, err
+		}
+		if endSec <= startSec {
+			return nil, fmt.Errorf("time band %q ends before it starts", name)
+		}
+		bands = append(bands, band)
+	}
+	return bands, nil
+}
+
+func padClock(value string) string {
+	if strings.Count(value, ":") == 1 {
+		return value + ":00"
+	}
+	return value
+}
+
+// routeTripsOn returns the trips of a route that run on a service date.
+func routeTripsOn(routeID string, date time.Time) []processing.Trip {
+	var trips []processing.Trip
+	for _, tripID := range RouteTripsMap[routeID] {
+		trip, found := findTripByID(tripID)
+		if found && serviceRunsOn(trip.ServiceID, date) {
+			trips = append(trips, trip)
+		}
+	}
+	return trips
+}
+
+// computeHeadways derives scheduled headways at every stop served by the
+// route on the service date, split by direction and time band. Only gaps
+// between two departures inside the same band are counted.
+func computeHeadways(routeID string, date time.Time, bands []processing.TimeBand) []processing.HeadwayStat {
+	type stopKey struct {
+		directionID int
+		stopID      string
+	}
+
+	departures := make(map[stopKey][]int)
+	for _, trip := range routeTripsOn(routeID, date) {
+		stopTimes, _ := findStopTimesByTripID(trip.TripID)
+		for _, st := range stopTimes {
+			seconds, err := processing.ParseGTFSTime(st.DepartureTime)
+			if err != nil {
+				continue
+			}
+			key := stopKey{directionID: trip.DirectionID, stopID: st.StopID}
+			departures[key] = append(departures[key], seconds)
+		}
+	}
+
+	var stats []processing.HeadwayStat
+	for key, times := range departures {
+		sort.Ints(times)
+
+		stopName := ""
+		if stop, ok := findStopById(key.stopID); ok {
+			stopName = stop.StopName
+		}
+
+		for _, band := range bands {
+			start, _ := processing.ParseGTFSTime(band.Start)
+			end, _ := processing.ParseGTFSTime(band.End)
+
+			var inBand []int
+			for _, t := range times {
+				if t >= start && t < end {
+					inBand = append(inBand, t)
+				}
+			}
+			if len(inBand) == 0 {
+				continue
+			}
+
+			stat := processing.HeadwayStat{
+				RouteID:     routeID,
+				DirectionID: key.directionID,
+				StopID:      key.stopID,
+				StopName:    stopName,
+				Band:        band.Name,
+				Departures:  len(inBand),
+			}
+
+			var gaps []float64
+			for i := 1; i < len(inBand); i++ {
+				gaps = append(gaps, float64(inBand[i]-inBand[i-1])/60)
+			}
+			if len(gaps) > 0 {
+				sort.Float64s(gaps)
+				total := 0.0
+				for _, g := range gaps {
+					total += g
+				}
+				stat.MinHeadway = gaps[0]
+				stat.MaxHeadway = gaps[len(gaps)-1]
+				stat.MeanHeadway = total / float64(len(gaps))
+				if len(gaps)%2 == 1 {
+					stat.MedianHeadway = gaps[len(gaps)/2]
+				} else {
+					stat.MedianHeadway = (gaps[len(gaps)/2-1] + gaps[len(gaps)/2]) / 2
+				}
+			}
+
+			stats = append(stats, stat)
+		}
+	}
+
+	bandOrder := make(map[string]int)
+	for i, band := range bands {
+		bandOrder[band.Name] = i
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.DirectionID != b.DirectionID {
+			return a.DirectionID < b.DirectionID
+		}
+		if a.StopID != b.StopID {
+			return a.StopID < b.StopID
+		}
+		return bandOrder[a.Band] < bandOrder[b.Band]
+	})
+
+	return stats
+}
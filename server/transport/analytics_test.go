@@ -0,0 +1,16 @@
+package transport
+
+import "testing"
+
+func TestParseTimeBands(t *testing.T) {
+	for _, value := range []string{"=06:00-09:00", " =06:00-09:00", "am=06:00-09:00,am=09:00-12:00", "am=09:00-06:00"} {
+		if _, err := parseTimeBands(value); err == nil {
+			t.Errorf("%q was accepted", value)
+		}
+	}
+
+	bands, err := parseTimeBands("am=06:00-09:00, pm=15:00-18:00")
+	if err != nil || len(bands) != 2 || bands[0].Name != "am" || bands[1].Name != "pm" || bands[1].Start != "15:00:00" {
+		t.Errorf("got %+v %v, want am and pm", bands, err)
+	}
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"sort"
+	"time"
+)
+
+// buildBlock chains the trips of a block that run on the given service date,
+// ordered by their first departure. A trip is flagged as interlined when its
+// route differs from the trip the vehicle ran immediately before it.
+func buildBlock(blockID string, tripIDs []string, date time.Time) processing.Block {
+	type orderedTrip struct {
+		start int
+		trip  processing.BlockTrip
+	}
+
+	var ordered []orderedTrip
+	for _, tripID := range tripIDs {
+		trip, found := findTripByID(tripID)
+		if !found || !serviceRunsOn(trip.ServiceID, date) {
+			continue
+		}
+
+		blockTrip := processing.BlockTrip{
+			TripID:       trip.TripID,
+			RouteID:      trip.RouteID,
+			ServiceID:    trip.ServiceID,
+			TripHeadsign: trip.TripHeadsign,
+			DirectionID:  trip.DirectionID,
+		}
+
+		start := 0
+		if stopTimes, ok := findStopTimesByTripID(tripID); ok && len(stopTimes) > 0 {
+			first := stopTimes[0]
+			last := stopTimes[len(stopTimes)-1]
+			start, _ = processing.ParseGTFSTime(first.DepartureTime)
+
+			blockTrip.StartTime = first.DepartureTime
+			blockTrip.EndTime = last.ArrivalTime
+			blockTrip.StartStopID = first.StopID
+			blockTrip.EndStopID = last.StopID
+			if stop, ok := findStopById(first.StopID); ok {
+				blockTrip.StartStopName = stop.StopName
+			}
+			if stop, ok := findStopById(last.StopID); ok {
+				blockTrip.EndStopName = stop.StopName
+			}
+		}
+
+		ordered = append(ordered, orderedTrip{start: start, trip: blockTrip})
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].start < ordered[j].start
+	})
+
+	block := processing.Block{
+		BlockID:     blockID,
+		ServiceDate: date.Format(serviceDateLayout),
+		Trips:       make([]processing.BlockTrip, 0, len(ordered)),
+		RouteIDs:    []string{},
+	}
+
+	seenRoutes := make(map[string]bool)
+	for i, o := range ordered {
+		if i > 0 {
+			previous := ordered[i-1].trip.RouteID
+			if previous != o.trip.RouteID {
+				o.trip.Interlined = true
+				o.trip.PreviousRouteID = previous
+				block.Interlined = true
+			}
+		}
+		if !seenRoutes[o.trip.RouteID] {
+			seenRoutes[o.trip.RouteID] = true
+			block.RouteIDs = append(block.RouteIDs, o.trip.RouteID)
+		}
+		block.Trips = append(block.Trips, o.trip)
+	}
+
+	return block
+}
@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"strconv"
+	"time"
+)
+
+const serviceDateLayout = "20060102"
+
+var CalendarMap = make(map[string]processing.Calendar)
+var CalendarDatesMap = make(map[string]map[string]int) // service_id -> date -> exception_type
+var AgencyLocation = time.Local
+
+func InitAgency() {
+	if len(processing.AgencyData) == 0 {
+		return
+	}
+	loc, err := time.LoadLocation(processing.AgencyData[0].AgencyTimezone)
+	if err != nil {
+		fmt.Printf("Unable to load agency timezone %s, using local time: %v\n", processing.AgencyData[0].AgencyTimezone, err)
+		return
+	}
+	AgencyLocation = loc
+	fmt.Printf("Agency timezone set to %s\n", loc)
+}
+
+func InitCalendarMaps() {
+	for _, cal := range processing.CalendarData {
+		CalendarMap[cal.ServiceID] = cal
+	}
+	for _, cd := range processing.CalendarDateData {
+		if CalendarDatesMap[cd.ServiceID] == nil {
+			CalendarDatesMap[cd.ServiceID] = make(map[string]int)
+		}
+		CalendarDatesMap[cd.ServiceID][cd.Date] = cd.ExceptionType
+	}
+	fmt.Printf("CalendarMap initialized with %d services and %d exception services\n", len(CalendarMap), len(CalendarDatesMap))
+}
+
+// serviceRunsOn reports whether a service_id is active on the given service
+// date, applying calendar_dates exceptions on top of the weekly calendar.
+func serviceRunsOn(serviceID string, date time.Time) bool {
+	key := date.Format(serviceDateLayout)
+	if exceptions, ok := CalendarDatesMap[serviceID]; ok {
+		switch exceptions[key] {
+		case 1:
+			return true
+		case 2:
+			return false
+		}
+	}
+
+	cal, ok := CalendarMap[serviceID]
+	if !ok {
+		return false
+	}
+	if key < cal.StartDate || key > cal.EndDate {
+		return false
+	}
+	return cal.Weekdays[date.Weekday()]
+}
+
+// activeServices returns the set of service_ids running on a service date.
+func activeServices(date time.Time) map[string]bool {
+	active := make(map[string]bool)
+	for serviceID := range CalendarMap {
+		if serviceRunsOn(serviceID, date) {
+			active[serviceID] = true
+		}
+	}
+	for serviceID := range CalendarDatesMap {
+		if serviceRunsOn(serviceID, date) {
+			active[serviceID] = true
+		}
+	}
+	return active
+}
+
+// parseServiceDate reads a YYYYMMDD date, defaulting to today in the agency
+// timezone when the value is empty.
+func parseServiceDate(value string) (time.Time, error) {
+	if value == "" {
+		now := clockNow().In(AgencyLocation)
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, AgencyLocation), nil
+	}
+	date, err := time.ParseInLocation(serviceDateLayout, value, AgencyLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be formatted as YYYYMMDD")
+	}
+	return date, nil
+}
+
+// serviceDayStart returns the reference time GTFS stop times are measured
+// from: noon minus twelve hours, which only differs from midnight on DST days.
+func serviceDayStart(date time.Time) time.Time {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, AgencyLocation)
+	return noon.Add(-12 * time.Hour)
+}
+
+// parseRequestTime accepts unix seconds or RFC3339, defaulting to now.
+func parseRequestTime(value string) (time.Time, error) {
+	if value == "" {
+		return clockNow(), nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be unix seconds or RFC3339")
+	}
+	return t, nil
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// Everything time dependent reads the time through clockNow. It is the
+// wall clock, except in replay mode where it is a virtual clock that can
+// run faster, be paused or jump to another moment.
+
+type virtualClock struct {
+	mu      sync.Mutex
+	virtual bool
+	base    time.Time // virtual time at anchor
+	anchor  time.Time // wall time when base was taken
+	speed   float64
+	paused  bool
+}
+
+var clock = &virtualClock{speed: 1}
+
+func clockNow() time.Time {
+	return clock.now()
+}
+
+func (c *virtualClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *virtualClock) nowLocked() time.Time {
+	if !c.virtual {
+		return time.Now()
+	}
+	if c.paused {
+		return c.base
+	}
+	elapsed := float64(time.Since(c.anchor)) * c.speed
+	return c.base.Add(time.Duration(elapsed))
+}
+
+// start switches to virtual time beginning at the given moment.
+func (c *virtualClock) start(at time.Time, speed float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.virtual = true
+	c.base, c.anchor = at, time.Now()
+	c.speed = speed
+}
+
+// seek moves the virtual time, keeping the speed and pause state.
+func (c *virtualClock) seek(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.base, c.anchor = at, time.Now()
+}
+
+func (c *virtualClock) setSpeed(speed float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.base, c.anchor = c.nowLocked(), time.Now()
+	c.speed = speed
+}
+
+func (c *virtualClock) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.base, c.anchor = c.nowLocked(), time.Now()
+	c.paused = paused
+}
+
+// state returns the virtual time, speed and pause state together.
+func (c *virtualClock) state() (time.Time, float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked(), c.speed, c.paused
+}
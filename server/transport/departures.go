@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"sort"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// departureLookback keeps scheduled departures slightly in the past so that
+// late vehicles still appear on the board.
+const departureLookback = 30 * time.Minute
+
+// indexTripUpdates maps trip_id to its TripUpdates for quick lookups. A
+// trip can have several, one per service day it runs on; pickTripUpdate
+// chooses among them.
+func indexTripUpdates(feed *gtfs.FeedMessage) map[string][]*gtfs.TripUpdate {
+	index := make(map[string][]*gtfs.TripUpdate)
+	if feed == nil {
+		return index
+	}
+	for _, entity := range feed.Entity {
+		if entity.TripUpdate == nil || entity.TripUpdate.GetTrip().GetTripId() == "" {
+			continue
+		}
+		tripID := entity.TripUpdate.GetTrip().GetTripId()
+		index[tripID] = append(index[tripID], entity.TripUpdate)
+	}
+	return index
+}
+
+// applyTripUpdate merges the realtime state of a trip into a scheduled
+// departure, as predicted for its stop by the prediction engine.
+func applyTripUpdate(departure *processing.Departure, tu *gtfs.TripUpdate) {
+	if tu == nil {
+		return
+	}
+	if startDate := tu.GetTrip().GetStartDate(); startDate != "" && startDate != departure.ServiceDate {
+		return
+	}
+
+	departure.VehicleID = tu.GetVehicle().GetId()
+	if tu.GetTrip().GetScheduleRelationship() == gtfs.TripDescriptor_CANCELED {
+		departure.Realtime = true
+		departure.Canceled = true
+		return
+	}
+
+	stopTimes, _ := findStopTimesByTripID(departure.TripID)
+	sequences, arrivals, departures, ok := tripSchedule(stopTimes)
+	if !ok {
+		return
+	}
+	dayStart := departure.ScheduledTime - int64(departureSeconds(departure))
+	predicted := predictStops(departure.TripID, sequences, arrivals, departures, dayStart, tu)
+
+	for pos, sequence := range sequences {
+		if sequence != departure.StopSequence {
+			continue
+		}
+		p := predicted[pos]
+		switch {
+		case p.skipped:
+			departure.Realtime = true
+			departure.Skipped = true
+		case p.realtime:
+			departure.Realtime = true
+			departure.PredictedTime = dayStart + int64(p.departure)
+			departure.Delay = departure.PredictedTime - departure.ScheduledTime
+		}
+		return
+	}
+}
+
+// stopTimeUpdateSequence returns the stop_sequence an update refers to, or
+// -1 if unknown. When only stop_id is given it is looked up in the trip's
+// stop times after the sequence matched last, so that a loop trip calling
+// twice at a stop resolves to the right visit, and else at its first visit.
+func stopTimeUpdateSequence(stopTimes []processing.StopTime, after int, stu *gtfs.TripUpdate_StopTimeUpdate) int {
+	if stu.StopSequence != nil {
+		return int(stu.GetStopSequence())
+	}
+	first := -1
+	for _, st := range stopTimes {
+		if st.StopID != stu.GetStopId() {
+			continue
+		}
+		if st.StopSequence > after {
+			return st.StopSequence
+		}
+		if first < 0 {
+			first = st.StopSequence
+		}
+	}
+	return first
+}
+
+func departureSeconds(departure *processing.Departure) int {
+	seconds, _ := processing.ParseGTFSTime(departure.ScheduledDeparture)
+	return seconds
+}
+
+// buildDepartures lists the next departures from a stop after the given
+// time. The previous service day is included so that trips running past
+// midnight are not lost. A stop the wheelchair filter rules out has none.
+func buildDepartures(stopID string, from time.Time, limit int, tripUpdates map[string][]*gtfs.TripUpdate, wheelchair wheelchairFilter) []processing.Departure {
+	if stop, ok := findStopById(stopID); ok && !wheelchair.allows(stopWheelchairBoarding(stop)) {
+		return nil
+	}
+	stopTimes, _ := findStopTimesByStopID(stopID)
+	local := from.In(AgencyLocation)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, AgencyLocation)
+
+	var departures []processing.Departure
+	for _, date := range []time.Time{today.AddDate(0, 0, -1), today} {
+		dayStart := serviceDayStart(date)
+		serviceDate := date.Format(serviceDateLayout)
+
+		for _, st := range stopTimes {
+			if st.PickupType == 1 {
+				continue
+			}
+			trip, found := findTripByID(st.TripID)
+			if !found || !serviceRunsOn(trip.ServiceID, date) || !wheelchair.allows(trip.WheelchairAccessible) {
+				continue
+			}
+			seconds, err := processing.ParseGTFSTime(st.DepartureTime)
+			if err != nil {
+				continue
+			}
+			scheduled := dayStart.Add(time.Duration(seconds) * time.Second)
+			if scheduled.Before(from.Add(-departureLookback)) {
+				continue
+			}
+
+			departure := processing.Departure{
+				TripID:             trip.TripID,
+				RouteID:            trip.RouteID,
+				Headsign:           trip.TripHeadsign,
+				DirectionID:        trip.DirectionID,
+				StopID:             st.StopID,
+				StopSequence:       st.StopSequence,
+				ServiceDate:        serviceDate,
+				ScheduledDeparture: st.DepartureTime,
+				ScheduledTime:      scheduled.Unix(),
+				Accessibility:      wheelchairLabel(trip.WheelchairAccessible),
+			}
+			if st.StopHeadsign != "" {
+				departure.Headsign = st.StopHeadsign
+			}
+			if route, ok := findRouteByID(trip.RouteID); ok {
+				departure.RouteShortName = route.RouteShortName
+				departure.RouteColor = route.RouteColor
+			}
+
+			applyTripUpdate(&departure, pickTripUpdate(tripUpdates[trip.TripID], serviceDate))
+
+			if departureTime(departure) < from.Unix() {
+				continue
+			}
+			departures = append(departures, departure)
+		}
+	}
+
+	sort.Slice(departures, func(i, j int) bool {
+		return departureTime(departures[i]) < departureTime(departures[j])
+	})
+	if limit > 0 && len(departures) > limit {
+		departures = departures[:limit]
+	}
+	return departures
+}
+
+// departureTime is the best known departure, predicted when available.
+func departureTime(departure processing.Departure) int64 {
+	if departure.PredictedTime != 0 {
+		return departure.PredictedTime
+	}
+	return departure.ScheduledTime
+}
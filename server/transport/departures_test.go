@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// testServiceDate is the service day the fixtures run on, in UTC.
+var testServiceDate = time.Date(2025, 10, 25, 0, 0, 0, 0, time.UTC)
+
+// loadTestTrip puts a trip with stops s1, s2, ... into the static maps,
+// one stop every ten minutes from 08:00 with a minute dwell, and removes
+// it again when the test ends.
+func loadTestTrip(t *testing.T, tripID string, stops int) {
+	t.Helper()
+	location := AgencyLocation
+	AgencyLocation = time.UTC
+
+	TripsMap[tripID] = processing.Trip{TripID: tripID, RouteID: "r1"}
+	var stopTimes []processing.StopTime
+	var keys []string
+	for i := 1; i <= stops; i++ {
+		minutes := (i - 1) * 10
+		st := processing.StopTime{
+			TripID:        tripID,
+			StopID:        fmt.Sprintf("s%d", i),
+			StopSequence:  i,
+			ArrivalTime:   fmt.Sprintf("08:%02d:00", minutes),
+			DepartureTime: fmt.Sprintf("08:%02d:00", minutes+1),
+		}
+		stopTimes = append(stopTimes, st)
+		StopTimesMap[tripID+"_"+st.StopID] = st
+		keys = append(keys, tripID+"_"+st.StopID)
+	}
+	TripStopTimesMap[tripID] = stopTimes
+
+	t.Cleanup(func() {
+		AgencyLocation = location
+		delete(TripsMap, tripID)
+		delete(TripStopTimesMap, tripID)
+		for _, key := range keys {
+			delete(StopTimesMap, key)
+		}
+	})
+}
+
+// testScheduled is the unix time of a GTFS time on the test service day.
+func testScheduled(clock string) int64 {
+	seconds, _ := processing.ParseGTFSTime(clock)
+	return testServiceDate.Unix() + int64(seconds)
+}
+
+func skippedUpdate(sequence uint32) *gtfs.TripUpdate_StopTimeUpdate {
+	return &gtfs.TripUpdate_StopTimeUpdate{
+		StopSequence:         proto.Uint32(sequence),
+		ScheduleRelationship: gtfs.TripUpdate_StopTimeUpdate_SKIPPED.Enum(),
+	}
+}
+
+func delayUpdate(sequence uint32, delay int32) *gtfs.TripUpdate_StopTimeUpdate {
+	return &gtfs.TripUpdate_StopTimeUpdate{
+		StopSequence: proto.Uint32(sequence),
+		Departure:    &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(delay)},
+	}
+}
+
+func TestApplyTripUpdateAfterSkippedStop(t *testing.T) {
+	loadTestTrip(t, "t1", 4)
+
+	tests := []struct {
+		name      string
+		updates   []*gtfs.TripUpdate_StopTimeUpdate
+		sequence  int
+		realtime  bool
+		skipped   bool
+		delay     int64
+		predicted int64
+	}{
+		{
+			name:     "skipped stop itself",
+			updates:  []*gtfs.TripUpdate_StopTimeUpdate{skippedUpdate(2)},
+			sequence: 2,
+			realtime: true,
+			skipped:  true,
+		},
+		{
+			name:     "only a skipped stop upstream",
+			updates:  []*gtfs.TripUpdate_StopTimeUpdate{skippedUpdate(2)},
+			sequence: 3,
+		},
+		{
+			name:      "delay carried past a skipped stop",
+			updates:   []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(1, 120), skippedUpdate(2)},
+			sequence:  3,
+			realtime:  true,
+			delay:     120,
+			predicted: testScheduled("08:21:00") + 120,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopTime := TripStopTimesMap["t1"][test.sequence-1]
+			departure := processing.Departure{
+				TripID:             "t1",
+				StopID:             stopTime.StopID,
+				StopSequence:       stopTime.StopSequence,
+				ServiceDate:        testServiceDate.Format(serviceDateLayout),
+				ScheduledDeparture: stopTime.DepartureTime,
+				ScheduledTime:      testScheduled(stopTime.DepartureTime),
+			}
+			tu := &gtfs.TripUpdate{
+				Trip:           &gtfs.TripDescriptor{TripId: proto.String("t1")},
+				StopTimeUpdate: test.updates,
+			}
+
+			applyTripUpdate(&departure, tu)
+
+			if departure.Realtime != test.realtime || departure.Skipped != test.skipped {
+				t.Fatalf("realtime %v skipped %v, want %v %v", departure.Realtime, departure.Skipped, test.realtime, test.skipped)
+			}
+			if departure.Delay != test.delay || departure.PredictedTime != test.predicted {
+				t.Errorf("delay %d predicted %d, want %d %d", departure.Delay, departure.PredictedTime, test.delay, test.predicted)
+			}
+		})
+	}
+}
+
+func TestBuildDeparturesPicksUpdateForServiceDate(t *testing.T) {
+	loadTestTrip(t, "t1", 4)
+	trip := TripsMap["t1"]
+	trip.ServiceID = "daily"
+	TripsMap["t1"] = trip
+	CalendarDatesMap["daily"] = map[string]int{
+		testServiceDate.AddDate(0, 0, -1).Format(serviceDateLayout): 1,
+		testServiceDate.Format(serviceDateLayout):                   1,
+	}
+	StopStopTimesMap["s4"] = TripStopTimesMap["t1"][3:]
+	t.Cleanup(func() {
+		delete(CalendarDatesMap, "daily")
+		delete(StopStopTimesMap, "s4")
+	})
+
+	dated := func(date time.Time, delay int32) *gtfs.FeedEntity {
+		return &gtfs.FeedEntity{
+			Id: proto.String(date.Format(serviceDateLayout)),
+			TripUpdate: &gtfs.TripUpdate{
+				Trip: &gtfs.TripDescriptor{
+					TripId:    proto.String("t1"),
+					StartDate: proto.String(date.Format(serviceDateLayout)),
+				},
+				StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(1, delay)},
+			},
+		}
+	}
+	// the update for the previous day comes last, it must not hide today's
+	feed := &gtfs.FeedMessage{Entity: []*gtfs.FeedEntity{
+		dated(testServiceDate, 120),
+		dated(testServiceDate.AddDate(0, 0, -1), 600),
+	}}
+
+	from := testServiceDate.Add(8 * time.Hour)
+	departures := buildDepartures("s4", from, 0, indexTripUpdates(feed), wheelchairAny)
+	if len(departures) != 1 {
+		t.Fatalf("got %d departures, want 1", len(departures))
+	}
+	if got := departures[0]; !got.Realtime || got.Delay != 120 {
+		t.Errorf("realtime %v delay %d, want true 120", got.Realtime, got.Delay)
+	}
+}
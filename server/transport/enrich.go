@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"strconv"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+)
+
+// With ?enrich=true the realtime endpoints inline the route, headsign, shape
+// and stop names of each entity, saving clients a lookup per vehicle.
+
+// enrichSlack is how far outside a trip's scheduled span a vehicle may be
+// while still being matched to that service day.
+const enrichSlack = 2 * time.Hour
+
+// parseEnrich reads ?enrich=true.
+func parseEnrich(c *gin.Context) (bool, error) {
+	value := c.Query("enrich")
+	if value == "" {
+		return false, nil
+	}
+	enrich, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("enrich must be true or false")
+	}
+	return enrich, nil
+}
+
+// tripEnrichment resolves a realtime trip against the schedule, nil when
+// neither the trip nor its route is known.
+func tripEnrichment(descriptor *gtfs.TripDescriptor) *processing.Enrichment {
+	trip, tripFound := findTripByID(descriptor.GetTripId())
+	routeID := descriptor.GetRouteId()
+	if routeID == "" {
+		routeID = trip.RouteID
+	}
+	route, routeFound := findRouteByID(routeID)
+	if !tripFound && !routeFound {
+		return nil
+	}
+	return &processing.Enrichment{
+		RouteShortName: route.RouteShortName,
+		RouteLongName:  route.RouteLongName,
+		RouteColor:     route.RouteColor,
+		RouteTextColor: route.RouteTextColor,
+		Headsign:       trip.TripHeadsign,
+		ShapeID:        trip.ShapeID,
+	}
+}
+
+// realtimeServiceDate picks the service date a trip is running on: its
+// start_date when given, otherwise whichever of today and yesterday has the
+// trip's schedule around the given time. ok is false when neither does, as
+// any date would then be a guess.
+func realtimeServiceDate(descriptor *gtfs.TripDescriptor, stopTimes []processing.StopTime, at time.Time) (time.Time, bool) {
+	if startDate := descriptor.GetStartDate(); startDate != "" {
+		date, err := time.ParseInLocation(serviceDateLayout, startDate, AgencyLocation)
+		return date, err == nil
+	}
+	if len(stopTimes) == 0 {
+		return time.Time{}, false
+	}
+	first, errFirst := processing.ParseGTFSTime(stopTimes[0].DepartureTime)
+	last, errLast := processing.ParseGTFSTime(stopTimes[len(stopTimes)-1].ArrivalTime)
+	if errFirst != nil || errLast != nil {
+		return time.Time{}, false
+	}
+
+	local := at.In(AgencyLocation)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, AgencyLocation)
+	slack := int64(enrichSlack.Seconds())
+	for _, date := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		dayStart := serviceDayStart(date).Unix()
+		if at.Unix() >= dayStart+int64(first)-slack && at.Unix() <= dayStart+int64(last)+slack {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// realtimeDayStart is the start of the trip's service day in unix seconds.
+func realtimeDayStart(descriptor *gtfs.TripDescriptor, stopTimes []processing.StopTime, at time.Time) (int64, bool) {
+	date, ok := realtimeServiceDate(descriptor, stopTimes, at)
+	if !ok {
+		return 0, false
+	}
+	return serviceDayStart(date).Unix(), true
+}
+
+func enrichedStop(st processing.StopTime, dayStart int64, known bool) *processing.EnrichedStop {
+	stop, _ := findStopById(st.StopID)
+	enriched := &processing.EnrichedStop{
+		StopID:           st.StopID,
+		StopName:         stop.StopName,
+		StopSequence:     st.StopSequence,
+		ScheduledArrival: st.ArrivalTime,
+	}
+	if seconds, err := processing.ParseGTFSTime(st.ArrivalTime); err == nil && known {
+		enriched.ScheduledTime = dayStart + int64(seconds)
+	}
+	return enriched
+}
+
+// nextScheduledStop is the index of the first stop scheduled at or after
+// the given time, -1 when the trip is over.
+func nextScheduledStop(stopTimes []processing.StopTime, dayStart int64, at time.Time) int {
+	for i, st := range stopTimes {
+		if seconds, err := processing.ParseGTFSTime(st.ArrivalTime); err == nil && dayStart+int64(seconds) >= at.Unix() {
+			return i
+		}
+	}
+	return -1
+}
+
+// enrichVehicle places the vehicle on its trip. The feed's
+// current_stop_sequence or else its stop_id gives the current stop, the
+// sequence first as loop trips visit a stop twice. The next stop is the one
+// after it when the vehicle is stopped there, or the same one while it is
+// still on its way. Without either the schedule decides.
+func enrichVehicle(v *gtfs.VehiclePosition, now time.Time) *processing.Enrichment {
+	enrichment := tripEnrichment(v.GetTrip())
+	if enrichment == nil {
+		return nil
+	}
+
+	stopTimes, _ := findStopTimesByTripID(v.GetTrip().GetTripId())
+	at := now
+	if ts := v.GetTimestamp(); ts != 0 {
+		at = time.Unix(int64(ts), 0)
+	}
+	dayStart, known := realtimeDayStart(v.GetTrip(), stopTimes, at)
+
+	current := -1
+	for i, st := range stopTimes {
+		if v.CurrentStopSequence != nil && st.StopSequence == int(v.GetCurrentStopSequence()) {
+			current = i
+			break
+		}
+	}
+	for i, st := range stopTimes {
+		if current < 0 && v.GetStopId() != "" && st.StopID == v.GetStopId() {
+			current = i
+			break
+		}
+	}
+
+	next := -1
+	switch {
+	case current >= 0:
+		enrichment.CurrentStop = enrichedStop(stopTimes[current], dayStart, known)
+		next = current
+		if v.GetCurrentStatus() == gtfs.VehiclePosition_STOPPED_AT {
+			next++
+		}
+	case known:
+		next = nextScheduledStop(stopTimes, dayStart, at)
+	}
+	if next >= 0 && next < len(stopTimes) {
+		enrichment.NextStop = enrichedStop(stopTimes[next], dayStart, known)
+	}
+	return enrichment
+}
+
+// enrichTripUpdate adds the route and trip details and the next stop the
+// schedule has the trip reaching.
+func enrichTripUpdate(tu *gtfs.TripUpdate, now time.Time) *processing.Enrichment {
+	enrichment := tripEnrichment(tu.GetTrip())
+	if enrichment == nil {
+		return nil
+	}
+
+	stopTimes, _ := findStopTimesByTripID(tu.GetTrip().GetTripId())
+	if dayStart, known := realtimeDayStart(tu.GetTrip(), stopTimes, now); known {
+		if next := nextScheduledStop(stopTimes, dayStart, now); next >= 0 {
+			enrichment.NextStop = enrichedStop(stopTimes[next], dayStart, known)
+		}
+	}
+	return enrichment
+}
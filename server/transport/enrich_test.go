@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEnrichVehicleOnLoopTrip(t *testing.T) {
+	loadTestTrip(t, "loop", 3)
+	// the loop returns to where it started
+	TripStopTimesMap["loop"][2].StopID = "s1"
+
+	vehicle := &gtfs.VehiclePosition{
+		Trip:                &gtfs.TripDescriptor{TripId: proto.String("loop"), StartDate: proto.String("20251025")},
+		StopId:              proto.String("s1"),
+		CurrentStopSequence: proto.Uint32(3),
+		CurrentStatus:       gtfs.VehiclePosition_STOPPED_AT.Enum(),
+		Timestamp:           proto.Uint64(uint64(testScheduled("08:20:00"))),
+	}
+	enrichment := enrichVehicle(vehicle, time.Unix(testScheduled("08:20:00"), 0))
+	if enrichment == nil || enrichment.CurrentStop == nil {
+		t.Fatal("vehicle was not placed on its trip")
+	}
+	if enrichment.CurrentStop.StopSequence != 3 {
+		t.Errorf("current stop sequence %d, want 3", enrichment.CurrentStop.StopSequence)
+	}
+	if enrichment.NextStop != nil {
+		t.Errorf("next stop %+v after the last stop", enrichment.NextStop)
+	}
+}
+
+func TestRealtimeServiceDateDoesNotGuess(t *testing.T) {
+	loadTestTrip(t, "t1", 3)
+	stopTimes, _ := findStopTimesByTripID("t1")
+
+	// the trip runs 08:00 to 08:21, well away from 20:00
+	if date, ok := realtimeServiceDate(nil, stopTimes, time.Unix(testScheduled("20:00:00"), 0)); ok {
+		t.Errorf("got %s, want no service date", date.Format(serviceDateLayout))
+	}
+	date, ok := realtimeServiceDate(nil, stopTimes, time.Unix(testScheduled("08:10:00"), 0))
+	if !ok || !date.Equal(testServiceDate) {
+		t.Errorf("got %s %v, want %s", date.Format(serviceDateLayout), ok, testServiceDate.Format(serviceDateLayout))
+	}
+}
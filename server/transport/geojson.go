@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const geoJSONContentType = "application/geo+json"
+
+// wantsGeoJSON reports whether the client asked for GeoJSON, either with
+// ?format=geojson or an Accept header of application/geo+json.
+func wantsGeoJSON(c *gin.Context) bool {
+	if c.Query("format") == "geojson" {
+		return true
+	}
+	return strings.Contains(c.GetHeader("Accept"), geoJSONContentType)
+}
+
+func renderGeoJSON(c *gin.Context, status int, collection processing.FeatureCollection) {
+	c.Header("Content-Type", geoJSONContentType)
+	c.JSON(status, collection)
+}
+
+func newFeatureCollection(features []processing.Feature) processing.FeatureCollection {
+	if features == nil {
+		features = []processing.Feature{}
+	}
+	return processing.FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func stopFeature(stop processing.Stop) processing.Feature {
+	return processing.Feature{
+		Type: "Feature",
+		ID:   stop.StopID,
+		Geometry: processing.Geometry{
+			Type:        "Point",
+			Coordinates: []float64{stop.StopLon, stop.StopLat},
+		},
+		Properties: map[string]interface{}{
+			"stop_id":             stop.StopID,
+			"stop_code":           stop.StopCode,
+			"stop_name":           stop.StopName,
+			"stop_desc":           stop.StopDesc,
+			"zone_id":             stop.ZoneID,
+			"location_type":       stop.LocationType,
+			"parent_station":      stop.ParentStation,
+			"wheelchair_boarding": stop.WheelchairBoarding,
+		},
+	}
+}
+
+func shapeCoordinates(shape []processing.Shape) [][]float64 {
+	coordinates := make([][]float64, 0, len(shape))
+	for _, pt := range sortedShape(shape) {
+		coordinates = append(coordinates, []float64{pt.ShapePtLon, pt.ShapePtLat})
+	}
+	return coordinates
+}
+
+func shapeFeature(shapeID string, shape []processing.Shape) processing.Feature {
+	return processing.Feature{
+		Type: "Feature",
+		ID:   shapeID,
+		Geometry: processing.Geometry{
+			Type:        "LineString",
+			Coordinates: shapeCoordinates(shape),
+		},
+		Properties: map[string]interface{}{
+			"shape_id": shapeID,
+		},
+	}
+}
+
+// routeFeature merges every shape used by the route's trips into a single
+// MultiLineString carrying the route attributes.
+func routeFeature(route processing.Route) processing.Feature {
+	lines := [][][]float64{}
+	var shapeIDs []string
+	for _, shapeID := range RouteShapesMap[route.RouteID] {
+		if shape, ok := findShapeById(shapeID); ok && len(shape) > 1 {
+			lines = append(lines, shapeCoordinates(shape))
+			shapeIDs = append(shapeIDs, shapeID)
+		}
+	}
+
+	return processing.Feature{
+		Type: "Feature",
+		ID:   route.RouteID,
+		Geometry: processing.Geometry{
+			Type:        "MultiLineString",
+			Coordinates: lines,
+		},
+		Properties: map[string]interface{}{
+			"route_id":         route.RouteID,
+			"agency_id":        route.AgencyID,
+			"route_short_name": route.RouteShortName,
+			"route_long_name":  route.RouteLongName,
+			"route_desc":       route.RouteDesc,
+			"route_type":       route.RouteType,
+			"route_url":        route.RouteURL,
+			"route_color":      route.RouteColor,
+			"route_text_color": route.RouteTextColor,
+			"shape_ids":        shapeIDs,
+		},
+	}
+}
+
+func vehicleFeature(v processing.VehiclePositionEntity) processing.Feature {
+	feature := processing.Feature{
+		Type: "Feature",
+		ID:   v.ID,
+		Geometry: processing.Geometry{
+			Type:        "Point",
+			Coordinates: []float64{v.Vehicle.Position.Longitude, v.Vehicle.Position.Latitude},
+		},
+		Properties: map[string]interface{}{
+			"vehicle_id":            v.Vehicle.Vehicle.ID,
+			"vehicle_label":         v.Vehicle.Vehicle.Label,
+			"trip_id":               v.Vehicle.Trip.TripID,
+			"route_id":              v.Vehicle.Trip.RouteID,
+			"direction_id":          v.Vehicle.Trip.DirectionID,
+			"schedule_relationship": v.Vehicle.Trip.ScheduleRelationship,
+			"bearing":               v.Vehicle.Position.Bearing,
+			"stop_id":               v.Vehicle.StopID,
+			"current_status":        v.Vehicle.CurrentStatus,
+			"timestamp":             v.Vehicle.Timestamp,
+			"occupancy_status":      v.Vehicle.OccupancyStatus,
+		},
+	}
+	if e := v.Enrichment; e != nil {
+		feature.Properties["route_short_name"] = e.RouteShortName
+		feature.Properties["route_color"] = e.RouteColor
+		feature.Properties["route_text_color"] = e.RouteTextColor
+		feature.Properties["headsign"] = e.Headsign
+		feature.Properties["shape_id"] = e.ShapeID
+		if e.CurrentStop != nil {
+			feature.Properties["current_stop_name"] = e.CurrentStop.StopName
+		}
+		if e.NextStop != nil {
+			feature.Properties["next_stop_id"] = e.NextStop.StopID
+			feature.Properties["next_stop_name"] = e.NextStop.StopName
+		}
+	}
+	return feature
+}
@@ -4,21 +4,27 @@ import (
 	"fmt"
 	"go-octo-eureka/server/processing"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
 	"github.com/gin-gonic/gin"
 )
 
 // GET /alerts
 func HandleAlert(c *gin.Context) {
-	feed, err := FetchAlerts()
+	snapshot, err := alertsPoller.latest()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching Alerts: %v", err)})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching Alerts: %v", err)})
 		return
 	}
+	setSnapshotHeaders(c, snapshot)
 
 	var results []processing.AlertEntity
 
-	for _, entity := range feed.Entity {
+	for _, entity := range snapshot.feed.Entity {
 		if entity.Alert == nil {
 			continue
 		}
@@ -78,16 +84,30 @@ func HandleAlert(c *gin.Context) {
 }
 
 // GET /tripupdates
+// Accepts the realtime filters route_id, trip_id, vehicle_id, stop_id,
+// direction_id, bbox and max_age, and enrich=true.
 func HandleTripUpdate(c *gin.Context) {
-	feed, err := FetchTripUpdates()
+	filter, err := parseRealtimeFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching TripUpdates: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	enrich, err := parseEnrich(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	snapshot, err := tripUpdatesPoller.latest()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching TripUpdates: %v", err)})
+		return
+	}
+	setSnapshotHeaders(c, snapshot)
 
-	var results []processing.TripUpdateEntity
+	results := []processing.TripUpdateEntity{}
+	now := clockNow()
 
-	for _, entity := range feed.Entity {
+	for _, entity := range snapshot.entities(filter) {
 		if entity.TripUpdate == nil {
 			continue
 		}
@@ -97,13 +117,24 @@ func HandleTripUpdate(c *gin.Context) {
 		// Map StopTimeUpdates
 		var stopTimeUpdates []processing.StopTimeUpdate
 		for _, stu := range tu.StopTimeUpdate {
-			stopTimeUpdates = append(stopTimeUpdates, processing.StopTimeUpdate{
+			update := processing.StopTimeUpdate{
 				StopSequence:         int(stu.GetStopSequence()),
 				StopID:               stu.GetStopId(),
 				Arrival:              processing.StopTimeEvent{Time: int64(stu.GetArrival().GetTime())},
 				Departure:            processing.StopTimeEvent{Time: int64(stu.GetDeparture().GetTime())},
 				ScheduleRelationship: int(stu.GetScheduleRelationship()),
-			})
+			}
+			if enrich {
+				if stop, ok := findStopById(stopTimeUpdateStopID(tu.GetTrip().GetTripId(), stu)); ok {
+					update.StopName = stop.StopName
+				}
+			}
+			stopTimeUpdates = append(stopTimeUpdates, update)
+		}
+
+		var enrichment *processing.Enrichment
+		if enrich {
+			enrichment = enrichTripUpdate(tu, now)
 		}
 
 		results = append(results, processing.TripUpdateEntity{
@@ -122,6 +153,7 @@ func HandleTripUpdate(c *gin.Context) {
 				StopTimeUpdate: stopTimeUpdates,
 				Timestamp:      int64(tu.GetTimestamp()),
 			},
+			Enrichment: enrichment,
 		})
 	}
 
@@ -129,16 +161,43 @@ func HandleTripUpdate(c *gin.Context) {
 }
 
 // GET /vehiclepositions
+// Accepts the same realtime filters and enrich=true as /tripupdates.
 func HandleVehiclePosition(c *gin.Context) {
-	feed, err := FetchVehiclePosition()
+	filter, err := parseRealtimeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enrich, err := parseEnrich(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	snapshot, err := vehiclePositionsPoller.latest()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching VehiclePositions: %v", err)})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching VehiclePositions: %v", err)})
 		return
 	}
+	setSnapshotHeaders(c, snapshot)
 
-	var results []processing.VehiclePositionEntity
+	vehicles := convertVehiclePositions(snapshot.entities(filter), enrich)
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(vehicles))
+		for _, v := range vehicles {
+			features = append(features, vehicleFeature(v))
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
 
-	for _, entity := range feed.Entity {
+	c.JSON(http.StatusOK, vehicles)
+}
+
+func convertVehiclePositions(entities []*gtfs.FeedEntity, enrich bool) []processing.VehiclePositionEntity {
+	results := []processing.VehiclePositionEntity{}
+	now := clockNow()
+
+	for _, entity := range entities {
 		if entity.Vehicle == nil {
 			continue
 		}
@@ -169,9 +228,12 @@ func HandleVehiclePosition(c *gin.Context) {
 				OccupancyStatus: int(v.GetOccupancyStatus()),
 			},
 		})
+		if enrich {
+			results[len(results)-1].Enrichment = enrichVehicle(v, now)
+		}
 	}
 
-	c.JSON(http.StatusOK, results)
+	return results
 }
 
 // GET /routes
@@ -180,6 +242,14 @@ func HandleRoutes(c *gin.Context) {
 	for _, r := range RoutesMap {
 		routes = append(routes, r)
 	}
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(routes))
+		for _, r := range routes {
+			features = append(features, routeFeature(r))
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
 	c.JSON(http.StatusOK, routes)
 }
 
@@ -189,6 +259,14 @@ func HandleStops(c *gin.Context) {
 	for _, s := range StopsMap {
 		stops = append(stops, s)
 	}
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(stops))
+		for _, s := range stops {
+			features = append(features, stopFeature(s))
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
 	c.JSON(http.StatusOK, stops)
 }
 
@@ -210,6 +288,10 @@ func HandleShapesById(c *gin.Context) {
 	}
 
 	if shape, found := findShapeById(id); found {
+		if wantsGeoJSON(c) {
+			renderGeoJSON(c, http.StatusOK, newFeatureCollection([]processing.Feature{shapeFeature(id, shape)}))
+			return
+		}
 		c.JSON(http.StatusOK, shape)
 	} else {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Shape not found"})
@@ -253,6 +335,10 @@ func HandleStopTimesByIds(c *gin.Context) {
 func HandleRoutesById(c *gin.Context) {
 	id := c.Param("id")
 	if route, found := findRouteByID(id); found {
+		if wantsGeoJSON(c) {
+			renderGeoJSON(c, http.StatusOK, newFeatureCollection([]processing.Feature{routeFeature(route)}))
+			return
+		}
 		c.JSON(http.StatusOK, route)
 	} else {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Route with ID %s not found", id)})
@@ -263,6 +349,10 @@ func HandleRoutesById(c *gin.Context) {
 func HandleStopsById(c *gin.Context) {
 	id := c.Param("id")
 	if stop, found := findStopById(id); found {
+		if wantsGeoJSON(c) {
+			renderGeoJSON(c, http.StatusOK, newFeatureCollection([]processing.Feature{stopFeature(stop)}))
+			return
+		}
 		c.JSON(http.StatusOK, stop)
 	} else {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Stop with ID %s not found", id)})
@@ -278,3 +368,620 @@ func HandleTripsById(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Trip with ID %s not found", id)})
 	}
 }
+
+// GET /trips/:id/realtime?date=YYYYMMDD
+// Every stop of the trip with its schedule and predicted times. Without a
+// date the trip's start_date in the feed is used, or else the service day
+// it is running on now.
+func HandleTripRealtime(c *gin.Context) {
+	id := c.Param("id")
+	trip, found := findTripByID(id)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Trip with ID %s not found", id)})
+		return
+	}
+
+	var date time.Time
+	if value := c.Query("date"); value != "" {
+		var err error
+		if date, err = parseServiceDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// realtime is best effort, the schedule is still useful without it
+	var tu *gtfs.TripUpdate
+	snapshot, err := tripUpdatesPoller.latest()
+	realtimeAvailable := err == nil
+	if realtimeAvailable {
+		setSnapshotHeaders(c, snapshot)
+		var updates []*gtfs.TripUpdate
+		for _, entity := range snapshot.entities(realtimeFilter{tripIDs: []string{id}}) {
+			if entity.TripUpdate != nil {
+				updates = append(updates, entity.TripUpdate)
+			}
+		}
+		serviceDate := ""
+		if !date.IsZero() {
+			serviceDate = date.Format(serviceDateLayout)
+		}
+		tu = pickTripUpdate(updates, serviceDate)
+	}
+
+	if date.IsZero() {
+		stopTimes, _ := findStopTimesByTripID(id)
+		date, _ = realtimeServiceDate(tu.GetTrip(), stopTimes, clockNow())
+		if date.IsZero() {
+			date, _ = parseServiceDate("")
+		}
+	}
+
+	prediction := predictTripRun(trip, date, tu)
+	prediction.RealtimeAvailable = realtimeAvailable
+	c.JSON(http.StatusOK, prediction)
+}
+
+// GET /trips/:id/track?from=&to=&format=geojson
+// Recorded positions of the vehicles that ran the trip, oldest first.
+func HandleTripTrack(c *gin.Context) {
+	id := c.Param("id")
+	from, to, err := parseTrackWindow(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	points := tripTrack(id, from, to)
+	if _, found := findTripByID(id); !found && len(points) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Trip with ID %s not found", id)})
+		return
+	}
+	renderTrack(c, processing.VehicleTrack{TripID: id, From: from, To: to, Points: points})
+}
+
+// GET /vehicles/:id/track?from=&to=&format=geojson
+// Recorded positions of one vehicle, oldest first.
+func HandleVehicleTrack(c *gin.Context) {
+	id := c.Param("id")
+	from, to, err := parseTrackWindow(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	points, found := vehicleTrack(id, from, to)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No history for vehicle with ID %s", id)})
+		return
+	}
+	renderTrack(c, processing.VehicleTrack{VehicleID: id, From: from, To: to, Points: points})
+}
+
+func renderTrack(c *gin.Context, track processing.VehicleTrack) {
+	if track.Points == nil {
+		track.Points = []processing.TrackPoint{}
+	}
+	if wantsGeoJSON(c) {
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(trackFeatures(track.Points)))
+		return
+	}
+	c.JSON(http.StatusOK, track)
+}
+
+// GET /blocks/:id?date=YYYYMMDD
+func HandleBlockById(c *gin.Context) {
+	id := processing.NormalizeBlockID(c.Param("id"))
+
+	date, err := parseServiceDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tripIDs, found := findBlockByID(id)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Block with ID %s not found", id)})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildBlock(id, tripIDs, date))
+}
+
+// GET /analytics/headways?route_id=&date=YYYYMMDD&bands=name=HH:MM-HH:MM,...&direction_id=&stop_id=
+func HandleHeadways(c *gin.Context) {
+	date, err := parseServiceDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bands, err := parseTimeBands(c.Query("bands"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var routeIDs []string
+	if routeID := c.Query("route_id"); routeID != "" {
+		if _, found := findRouteByID(routeID); !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Route with ID %s not found", routeID)})
+			return
+		}
+		routeIDs = append(routeIDs, routeID)
+	} else {
+		for routeID := range RoutesMap {
+			routeIDs = append(routeIDs, routeID)
+		}
+		sort.Strings(routeIDs)
+	}
+
+	directionID := c.Query("direction_id")
+	stopID := c.Query("stop_id")
+
+	results := []processing.HeadwayStat{}
+	for _, routeID := range routeIDs {
+		for _, stat := range computeHeadways(routeID, date, bands) {
+			if directionID != "" && directionID != strconv.Itoa(stat.DirectionID) {
+				continue
+			}
+			if stopID != "" && stopID != stat.StopID {
+				continue
+			}
+			results = append(results, stat)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service_date": date.Format(serviceDateLayout),
+		"bands":        bands,
+		"headways":     results,
+	})
+}
+
+// GET /routes/:id/timetable?direction_id=0&date=YYYYMMDD&format=json|csv|html
+func HandleRouteTimetable(c *gin.Context) {
+	id := c.Param("id")
+	route, found := findRouteByID(id)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Route with ID %s not found", id)})
+		return
+	}
+
+	directionID, err := strconv.Atoi(c.DefaultQuery("direction_id", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction_id must be 0 or 1"})
+		return
+	}
+
+	date, err := parseServiceDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timetable := buildTimetable(route, directionID, date)
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, timetable)
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=route_%s_%d_%s.csv", route.RouteID, directionID, timetable.ServiceDate))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := writeTimetableCSV(c.Writer, timetable); err != nil {
+			c.Error(err)
+		}
+	case "html":
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := writeTimetableHTML(c.Writer, timetable); err != nil {
+			c.Error(err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or html"})
+	}
+}
+
+// GET /routes/:id/patterns?direction_id=&shapes=true
+func HandleRoutePatterns(c *gin.Context) {
+	id := c.Param("id")
+	if _, found := findRouteByID(id); !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Route with ID %s not found", id)})
+		return
+	}
+
+	patterns, _ := findPatternsByRouteID(id)
+	directionID := c.Query("direction_id")
+	withShapes := c.Query("shapes") == "true"
+
+	results := []processing.StopPattern{}
+	for _, pattern := range patterns {
+		if directionID != "" && directionID != strconv.Itoa(pattern.DirectionID) {
+			continue
+		}
+		if withShapes && pattern.ShapeID != "" {
+			pattern.Shape, _ = findShapeById(pattern.ShapeID)
+		}
+		results = append(results, pattern)
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GET /routes/:id/stops?direction_id=
+func HandleRouteStops(c *gin.Context) {
+	id := c.Param("id")
+	if _, found := findRouteByID(id); !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Route with ID %s not found", id)})
+		return
+	}
+
+	directions, _ := findStopsByRouteID(id)
+	directionID := c.Query("direction_id")
+
+	results := []processing.RouteDirectionStops{}
+	for _, direction := range directions {
+		if directionID != "" && directionID != strconv.Itoa(direction.DirectionID) {
+			continue
+		}
+		results = append(results, direction)
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GET /stops/:id/routes
+func HandleStopRoutes(c *gin.Context) {
+	id := c.Param("id")
+	if _, found := findStopById(id); !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Stop with ID %s not found", id)})
+		return
+	}
+
+	routes, found := findRoutesByStopID(id)
+	if !found {
+		routes = []processing.StopRoute{}
+	}
+
+	c.JSON(http.StatusOK, routes)
+}
+
+// GET /stops/:id/transfers
+func HandleStopTransfers(c *gin.Context) {
+	id := c.Param("id")
+	if _, found := findStopById(id); !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Stop with ID %s not found", id)})
+		return
+	}
+
+	transfers, found := findTransfersByStopID(id)
+	if !found {
+		transfers = []processing.Transfer{}
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// GET /stops/:id/departures?time=&limit=&wheelchair=&include_unknown=
+func HandleStopDepartures(c *gin.Context) {
+	id := c.Param("id")
+	stop, found := findStopById(id)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Stop with ID %s not found", id)})
+		return
+	}
+
+	from, err := parseRequestTime(c.Query("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	wheelchair, err := parseWheelchairFilter(c.Query("wheelchair"), c.Query("include_unknown"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// realtime is best effort, the schedule is still useful without it
+	var tripUpdates map[string][]*gtfs.TripUpdate
+	snapshot, err := tripUpdatesPoller.latest()
+	realtimeAvailable := err == nil
+	if realtimeAvailable {
+		setSnapshotHeaders(c, snapshot)
+		tripUpdates = indexTripUpdates(snapshot.feed)
+	}
+
+	departures := buildDepartures(id, from, limit, tripUpdates, wheelchair)
+	if departures == nil {
+		departures = []processing.Departure{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stop_id":                  id,
+		"time":                     from.Unix(),
+		"wheelchair_accessibility": wheelchairLabel(stopWheelchairBoarding(stop)),
+		"realtime_available":       realtimeAvailable,
+		"departures":               departures,
+	})
+}
+
+// GET /stops/nearby?lat=&lon=&radius=&limit=&wheelchair=&include_unknown=
+func HandleStopsNearby(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+	if errLat != nil || errLon != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon query parameters required"})
+		return
+	}
+
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "500"), 64)
+	if err != nil || radius <= 0 || radius > maxNearbyRadius {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius must be between 0 and %.0f meters", maxNearbyRadius)})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	wheelchair, err := parseWheelchairFilter(c.Query("wheelchair"), c.Query("include_unknown"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stops []processing.NearbyStop
+	for _, s := range findStopsNearby(lat, lon, radius) {
+		if wheelchair.allows(stopWheelchairBoarding(s.Stop)) {
+			stops = append(stops, s)
+		}
+	}
+	if len(stops) > limit {
+		stops = stops[:limit]
+	}
+	if stops == nil {
+		stops = []processing.NearbyStop{}
+	}
+
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(stops))
+		for _, s := range stops {
+			feature := stopFeature(s.Stop)
+			feature.Properties["distance_meters"] = s.Distance
+			feature.Properties["wheelchair_accessibility"] = s.Accessibility
+			features = append(features, feature)
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
+
+	c.JSON(http.StatusOK, stops)
+}
+
+// GET /stops/bbox?bbox=min_lon,min_lat,max_lon,max_lat
+func HandleStopsInBoundingBox(c *gin.Context) {
+	minLat, minLon, maxLat, maxLon, err := parseBoundingBox(c.Query("bbox"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stops := findStopsWithin(minLat, minLon, maxLat, maxLon)
+	if stops == nil {
+		stops = []processing.Stop{}
+	}
+
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(stops))
+		for _, s := range stops {
+			features = append(features, stopFeature(s))
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
+
+	c.JSON(http.StatusOK, stops)
+}
+
+// GET /tiles/:z/:x/:y?layers=routes,stops,vehicles
+func HandleVectorTile(c *gin.Context) {
+	z, errZ := strconv.Atoi(c.Param("z"))
+	x, errX := strconv.Atoi(c.Param("x"))
+	y, errY := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(c.Param("y"), ".mvt"), ".pbf"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > 22 || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tile coordinates"})
+		return
+	}
+
+	layers := make(map[string]bool)
+	for _, layer := range strings.Split(c.DefaultQuery("layers", "routes,stops"), ",") {
+		layers[strings.TrimSpace(layer)] = true
+	}
+
+	var vehicles []processing.VehiclePositionEntity
+	if layers["vehicles"] {
+		snapshot, err := vehiclePositionsPoller.latest()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching VehiclePositions: %v", err)})
+			return
+		}
+		setSnapshotHeaders(c, snapshot)
+		vehicles = convertVehiclePositions(snapshot.feed.Entity, false)
+		c.Header("Cache-Control", "no-cache")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+
+	tile := buildTile(z, x, y, layers, vehicles)
+	c.Data(http.StatusOK, "application/vnd.mapbox-vector-tile", tile.Marshal())
+}
+
+// GET /search?q=&type=stop,route,headsign&limit=
+func HandleSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q query parameter required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	kinds := make(map[string]bool)
+	if types := c.Query("type"); types != "" {
+		for _, kind := range strings.Split(types, ",") {
+			kinds[strings.TrimSpace(kind)] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, SearchIndex.search(query, kinds, limit))
+}
+
+// GET /plan?from=stop_id|lat,lon&to=stop_id|lat,lon&time=&max_transfers=&walk_radius=&wheelchair=&include_unknown=
+func HandlePlan(c *gin.Context) {
+	radius, err := strconv.ParseFloat(c.DefaultQuery("walk_radius", strconv.FormatFloat(defaultAccessRadius, 'f', 0, 64)), 64)
+	if err != nil || radius <= 0 || radius > maxAccessRadius {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("walk_radius must be between 0 and %.0f meters", maxAccessRadius)})
+		return
+	}
+
+	wheelchair, err := parseWheelchairFilter(c.Query("wheelchair"), c.Query("include_unknown"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	origin, err := parsePlanEndpoint(c.Query("from"), radius, wheelchair)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from: %v", err)})
+		return
+	}
+	destination, err := parsePlanEndpoint(c.Query("to"), radius, wheelchair)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to: %v", err)})
+		return
+	}
+
+	departure, err := parseRequestTime(c.Query("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxTransfers, err := strconv.Atoi(c.DefaultQuery("max_transfers", strconv.Itoa(defaultMaxTransfers)))
+	if err != nil || maxTransfers < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_transfers must be a non-negative integer"})
+		return
+	}
+
+	useRealtime, err := strconv.ParseBool(c.DefaultQuery("realtime", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "realtime must be true or false"})
+		return
+	}
+
+	query := newPlanQuery(origin, destination, departure, maxTransfers)
+	query.wheelchair = wheelchair
+	realtimeAvailable := false
+	if useRealtime {
+		// realtime is best effort, fall back to the schedule without it
+		if snapshot, err := tripUpdatesPoller.latest(); err == nil {
+			setSnapshotHeaders(c, snapshot)
+			query.tripUpdates = indexTripUpdates(snapshot.feed)
+			realtimeAvailable = true
+		}
+	}
+
+	itineraries := query.plan()
+	if itineraries == nil {
+		itineraries = []processing.Itinerary{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":               origin.place,
+		"to":                 destination.place,
+		"time":               departure.Unix(),
+		"realtime_available": realtimeAvailable,
+		"itineraries":        itineraries,
+	})
+}
+
+// GET /isochrone?from=stop_id|lat,lon&time=&minutes=&max_transfers=&walk_radius=
+func HandleIsochrone(c *gin.Context) {
+	radius, err := strconv.ParseFloat(c.DefaultQuery("walk_radius", strconv.FormatFloat(defaultAccessRadius, 'f', 0, 64)), 64)
+	if err != nil || radius <= 0 || radius > maxAccessRadius {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("walk_radius must be between 0 and %.0f meters", maxAccessRadius)})
+		return
+	}
+
+	origin, err := parsePlanEndpoint(c.Query("from"), radius, wheelchairAny)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from: %v", err)})
+		return
+	}
+
+	departure, err := parseRequestTime(c.Query("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	minutes, err := strconv.Atoi(c.DefaultQuery("minutes", strconv.Itoa(defaultIsochroneMinutes)))
+	if err != nil || minutes <= 0 || minutes > maxIsochroneMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("minutes must be between 1 and %d", maxIsochroneMinutes)})
+		return
+	}
+
+	maxTransfers, err := strconv.Atoi(c.DefaultQuery("max_transfers", strconv.Itoa(defaultMaxTransfers)))
+	if err != nil || maxTransfers < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_transfers must be a non-negative integer"})
+		return
+	}
+
+	query := newPlanQuery(origin, planEndpoint{}, departure, maxTransfers)
+	stops, geometry := query.isochrone(minutes*60, radius)
+	area := processing.Feature{
+		Type:     "Feature",
+		Geometry: geometry,
+		Properties: map[string]interface{}{
+			"minutes":    minutes,
+			"time":       departure.Unix(),
+			"stop_count": len(stops),
+		},
+	}
+
+	if wantsGeoJSON(c) {
+		features := make([]processing.Feature, 0, len(stops)+1)
+		features = append(features, area)
+		for _, s := range stops {
+			feature := stopFeature(s.Stop)
+			feature.Properties["arrival_time"] = s.ArrivalTime
+			feature.Properties["travel_time"] = s.TravelTime
+			feature.Properties["transfers"] = s.Transfers
+			features = append(features, feature)
+		}
+		renderGeoJSON(c, http.StatusOK, newFeatureCollection(features))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    origin.place,
+		"time":    departure.Unix(),
+		"minutes": minutes,
+		"stops":   stops,
+		"polygon": area,
+	})
+}
@@ -1,17 +1,15 @@
 package transport
 
 import (
-	"context"
 	"fmt"
 	"go-octo-eureka/server/processing"
-	"io"
-	"net/http"
-	"time"
+	"sort"
 
 	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
 	"google.golang.org/protobuf/proto"
 )
 
+// RTD's public feeds, used unless LoadRealtimeSources is told otherwise.
 const rtdAlerts = "https://www.rtd-denver.com/files/gtfs-rt/Alerts.pb"
 const rtdTripUpdates = "https://www.rtd-denver.com/files/gtfs-rt/TripUpdate.pb"
 const rtdVehiclePosition = "https://www.rtd-denver.com/files/gtfs-rt/VehiclePosition.pb"
@@ -22,6 +20,10 @@ var StopsMap = make(map[string]processing.Stop)
 var TripsMap = make(map[string]processing.Trip)
 var StopTimesMap = make(map[string]processing.StopTime)
 var TripStopTimesMap = make(map[string][]processing.StopTime)
+var StopStopTimesMap = make(map[string][]processing.StopTime) // stop_id -> stop times at that stop
+var BlocksMap = make(map[string][]string)                     // block_id -> trip_ids
+var RouteTripsMap = make(map[string][]string)                 // route_id -> trip_ids
+var RouteShapesMap = make(map[string][]string)                // route_id -> distinct shape_ids
 
 func InitRouteMap() {
 	for _, route := range processing.RouteData {
@@ -47,8 +49,15 @@ func InitStopsMap() {
 func InitTripsMap() {
 	for _, trip := range processing.TripData {
 		TripsMap[trip.TripID] = trip
+		RouteTripsMap[trip.RouteID] = append(RouteTripsMap[trip.RouteID], trip.TripID)
+		if trip.ShapeID != "" && indexFrom(RouteShapesMap[trip.RouteID], trip.ShapeID, 0) < 0 {
+			RouteShapesMap[trip.RouteID] = append(RouteShapesMap[trip.RouteID], trip.ShapeID)
+		}
+		if trip.BlockID != "" {
+			BlocksMap[trip.BlockID] = append(BlocksMap[trip.BlockID], trip.TripID)
+		}
 	}
-	fmt.Printf("TripsMap initialized with %d trips\n", len(TripsMap))
+	fmt.Printf("TripsMap initialized with %d trips in %d blocks\n", len(TripsMap), len(BlocksMap))
 }
 
 func InitStopTimesMap() {
@@ -57,6 +66,12 @@ func InitStopTimesMap() {
 		StopTimesMap[key] = stopTime
 
 		TripStopTimesMap[stopTime.TripID] = append(TripStopTimesMap[stopTime.TripID], stopTime)
+		StopStopTimesMap[stopTime.StopID] = append(StopStopTimesMap[stopTime.StopID], stopTime)
+	}
+	for _, stopTimes := range TripStopTimesMap {
+		sort.Slice(stopTimes, func(i, j int) bool {
+			return stopTimes[i].StopSequence < stopTimes[j].StopSequence
+		})
 	}
 	fmt.Printf("StopTimesMap initialized. TripStopTimesMap has %d trips with schedules.\n", len(TripStopTimesMap))
 }
@@ -81,39 +96,31 @@ func findTripByID(tripId string) (processing.Trip, bool) {
 	return trip, found
 }
 
+func findBlockByID(blockId string) ([]string, bool) {
+	tripIDs, found := BlocksMap[blockId]
+	return tripIDs, found
+}
+
 func findStopTimesByTripID(tripId string) ([]processing.StopTime, bool) {
 	stopTimes, found := TripStopTimesMap[tripId]
 	return stopTimes, found
 }
 
+func findStopTimesByStopID(stopId string) ([]processing.StopTime, bool) {
+	stopTimes, found := StopStopTimesMap[stopId]
+	return stopTimes, found
+}
+
 func findStopTimeByTripAndStop(tripId, stopId string) (processing.StopTime, bool) {
 	key := fmt.Sprintf("%s_%s", tripId, stopId)
 	stopTime, found := StopTimesMap[key]
 	return stopTime, found
 }
 
-func fetchFeed(url string) (*gtfs.FeedMessage, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch GTFS-RT feed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad response status: %d", resp.StatusCode)
-	}
-
-	data, err := io.ReadAll(resp.Body)
+func fetchFeed(source *feedSource) (*gtfs.FeedMessage, error) {
+	data, err := source.read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read GTFS-RT data: %w", err)
+		return nil, err
 	}
 
 	feed := &gtfs.FeedMessage{}
@@ -125,13 +132,13 @@ func fetchFeed(url string) (*gtfs.FeedMessage, error) {
 }
 
 func FetchAlerts() (*gtfs.FeedMessage, error) {
-	return fetchFeed(rtdAlerts)
+	return fetchFeed(alertsSource)
 }
 
 func FetchTripUpdates() (*gtfs.FeedMessage, error) {
-	return fetchFeed(rtdTripUpdates)
+	return fetchFeed(tripUpdatesSource)
 }
 
 func FetchVehiclePosition() (*gtfs.FeedMessage, error) {
-	return fetchFeed(rtdVehiclePosition)
+	return fetchFeed(vehiclePositionsSource)
 }
@@ -0,0 +1,423 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every vehicle position the poller sees is kept in a per-vehicle ring
+// buffer so past tracks can be served. The buffers are bounded both by a
+// number of points and by age. With VEHICLE_HISTORY_DIR set the points are
+// also appended to one JSON lines file per day, which is read back on
+// startup so a restart does not lose the history.
+
+const (
+	defaultHistorySize      = 2880 // a day of 30 second polls
+	defaultHistoryRetention = 24 * time.Hour
+	defaultTrackWindow      = time.Hour
+	historyFilePrefix       = "positions-"
+	historyFileSuffix       = ".jsonl"
+)
+
+var history = struct {
+	size      int
+	retention time.Duration
+	dir       string
+}{size: defaultHistorySize, retention: defaultHistoryRetention}
+
+var vehicleHistoryMu sync.RWMutex
+var vehicleHistory = make(map[string]*trackRing)
+
+// historyFile is the open file of the current day, guarded by
+// vehicleHistoryMu.
+var historyFile *os.File
+var historyFileDate string
+
+// trackRing holds one vehicle's points oldest first. It grows up to the
+// configured size and then overwrites its oldest point.
+type trackRing struct {
+	points []processing.TrackPoint
+	start  int
+	count  int
+}
+
+func (r *trackRing) at(i int) processing.TrackPoint {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+func (r *trackRing) push(p processing.TrackPoint, size int) {
+	switch {
+	case r.count < len(r.points):
+		r.points[(r.start+r.count)%len(r.points)] = p
+		r.count++
+	case len(r.points) < size:
+		// full but allowed to grow, unwrap first so order is kept
+		unwrapped := make([]processing.TrackPoint, 0, len(r.points)+1)
+		for i := 0; i < r.count; i++ {
+			unwrapped = append(unwrapped, r.at(i))
+		}
+		r.points = append(unwrapped, p)
+		r.start = 0
+		r.count++
+	default:
+		r.points[r.start] = p
+		r.start = (r.start + 1) % len(r.points)
+	}
+}
+
+// dropBefore discards points older than the cutoff.
+func (r *trackRing) dropBefore(cutoff int64) {
+	for r.count > 0 && r.at(0).Timestamp < cutoff {
+		r.start = (r.start + 1) % len(r.points)
+		r.count--
+	}
+}
+
+// window returns the points in [from, to], oldest first.
+func (r *trackRing) window(from, to int64) []processing.TrackPoint {
+	var points []processing.TrackPoint
+	for i := 0; i < r.count; i++ {
+		if p := r.at(i); p.Timestamp >= from && p.Timestamp <= to {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// LoadVehicleHistory configures the history from VEHICLE_HISTORY_SIZE
+// (points kept per vehicle), VEHICLE_HISTORY_RETENTION (a duration such as
+// "12h") and VEHICLE_HISTORY_DIR, and reloads what was persisted there.
+func LoadVehicleHistory() error {
+	if value := os.Getenv("VEHICLE_HISTORY_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("VEHICLE_HISTORY_SIZE must be a positive integer, got %q", value)
+		}
+		history.size = size
+	}
+	if value := os.Getenv("VEHICLE_HISTORY_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil || retention <= 0 {
+			return fmt.Errorf("VEHICLE_HISTORY_RETENTION must be a positive duration, got %q", value)
+		}
+		history.retention = retention
+	}
+
+	history.dir = os.Getenv("VEHICLE_HISTORY_DIR")
+	if history.dir != "" && replaying() {
+		// replayed positions must not mix with the real history
+		fmt.Println("Replaying, VEHICLE_HISTORY_DIR is ignored and the history kept in memory only")
+		history.dir = ""
+	}
+	if history.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(history.dir, 0o755); err != nil {
+		return fmt.Errorf("VEHICLE_HISTORY_DIR: %w", err)
+	}
+
+	cutoff := clockNow().Add(-history.retention)
+	files, err := pruneHistoryFiles(cutoff)
+	if err != nil {
+		return err
+	}
+	loaded := 0
+	for _, file := range files {
+		n, err := loadHistoryFile(file, cutoff.Unix())
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		loaded += n
+	}
+	fmt.Printf("Vehicle history loaded with %d positions for %d vehicles\n", loaded, len(vehicleHistory))
+	return nil
+}
+
+// pruneHistoryFiles removes the day files whose every point is older than
+// the cutoff and returns the others, oldest first.
+func pruneHistoryFiles(cutoff time.Time) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(history.dir, historyFilePrefix+"*"+historyFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var kept []string
+	for _, file := range files {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), historyFilePrefix), historyFileSuffix)
+		day, err := time.ParseInLocation(serviceDateLayout, date, AgencyLocation)
+		if err == nil && day.AddDate(0, 0, 1).Before(cutoff) {
+			if err := os.Remove(file); err != nil {
+				log.Printf("Error removing expired vehicle history %s: %v", file, err)
+			}
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept, nil
+}
+
+func loadHistoryFile(file string, cutoff int64) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	loaded := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p processing.TrackPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			// a line cut short by a crash, the rest of the file is fine
+			continue
+		}
+		if p.Timestamp >= cutoff && addTrackPoint(p) {
+			loaded++
+		}
+	}
+	return loaded, scanner.Err()
+}
+
+// addTrackPoint stores a point unless the vehicle already has one as new.
+// vehicleHistoryMu must be held, or the history not yet shared.
+func addTrackPoint(p processing.TrackPoint) bool {
+	ring := vehicleHistory[p.VehicleID]
+	if ring == nil {
+		ring = &trackRing{}
+		vehicleHistory[p.VehicleID] = ring
+	}
+	if ring.count > 0 && ring.at(ring.count-1).Timestamp >= p.Timestamp {
+		return false
+	}
+	ring.push(p, history.size)
+	return true
+}
+
+// recordVehiclePositions adds the vehicles of a new feed to the history.
+// Entities without a timestamp of their own are dated by the feed header.
+func recordVehiclePositions(snapshot *feedSnapshot) {
+	var recorded []processing.TrackPoint
+	cutoff := clockNow().Add(-history.retention).Unix()
+
+	vehicleHistoryMu.Lock()
+	defer vehicleHistoryMu.Unlock()
+
+	for _, entity := range snapshot.feed.Entity {
+		v := entity.Vehicle
+		if v == nil || v.Position == nil {
+			continue
+		}
+		vehicleID := v.GetVehicle().GetId()
+		if vehicleID == "" {
+			vehicleID = entity.GetId()
+		}
+		timestamp := snapshot.entityTime(entity)
+		if timestamp.IsZero() {
+			timestamp = snapshot.fetchedAt
+		}
+
+		p := processing.TrackPoint{
+			VehicleID:     vehicleID,
+			TripID:        v.GetTrip().GetTripId(),
+			RouteID:       v.GetTrip().GetRouteId(),
+			Timestamp:     timestamp.Unix(),
+			Latitude:      float64(v.GetPosition().GetLatitude()),
+			Longitude:     float64(v.GetPosition().GetLongitude()),
+			Bearing:       float64(v.GetPosition().GetBearing()),
+			Speed:         float64(v.GetPosition().GetSpeed()),
+			StopID:        v.GetStopId(),
+			CurrentStatus: int(v.GetCurrentStatus()),
+		}
+		if p.RouteID == "" {
+			if trip, ok := findTripByID(p.TripID); ok {
+				p.RouteID = trip.RouteID
+			}
+		}
+		if p.Timestamp >= cutoff && addTrackPoint(p) {
+			recorded = append(recorded, p)
+		}
+	}
+
+	for vehicleID, ring := range vehicleHistory {
+		ring.dropBefore(cutoff)
+		if ring.count == 0 {
+			delete(vehicleHistory, vehicleID)
+		}
+	}
+
+	if history.dir != "" && len(recorded) > 0 {
+		if err := persistTrackPoints(recorded); err != nil {
+			log.Printf("Error persisting vehicle history: %v", err)
+		}
+	}
+}
+
+// persistTrackPoints appends points to the file of the current day,
+// starting a new file when the day changes and removing the files that
+// expired meanwhile. vehicleHistoryMu must be held.
+func persistTrackPoints(points []processing.TrackPoint) error {
+	date := clockNow().In(AgencyLocation).Format(serviceDateLayout)
+	if historyFile == nil || historyFileDate != date {
+		if historyFile != nil {
+			historyFile.Close()
+			historyFile = nil
+		}
+		if _, err := pruneHistoryFiles(clockNow().Add(-history.retention)); err != nil {
+			log.Printf("Error pruning vehicle history: %v", err)
+		}
+		f, err := os.OpenFile(filepath.Join(history.dir, historyFilePrefix+date+historyFileSuffix), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		historyFile, historyFileDate = f, date
+	}
+
+	w := bufio.NewWriter(historyFile)
+	encoder := json.NewEncoder(w)
+	for _, p := range points {
+		if err := encoder.Encode(p); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// CloseVehicleHistory flushes the open history file to disk, for a clean
+// shutdown. Later points open it again.
+func CloseVehicleHistory() {
+	vehicleHistoryMu.Lock()
+	defer vehicleHistoryMu.Unlock()
+
+	if historyFile == nil {
+		return
+	}
+	if err := historyFile.Sync(); err != nil {
+		log.Printf("Error syncing vehicle history: %v", err)
+	}
+	if err := historyFile.Close(); err != nil {
+		log.Printf("Error closing vehicle history: %v", err)
+	}
+	historyFile = nil
+}
+
+// forgetVehicleHistoryAfter drops the points newer than a replay seeks
+// back to, they have not happened yet.
+func forgetVehicleHistoryAfter(timestamp int64) {
+	vehicleHistoryMu.Lock()
+	defer vehicleHistoryMu.Unlock()
+
+	for vehicleID, ring := range vehicleHistory {
+		for ring.count > 0 && ring.at(ring.count-1).Timestamp > timestamp {
+			ring.count--
+		}
+		if ring.count == 0 {
+			delete(vehicleHistory, vehicleID)
+		}
+	}
+}
+
+// vehicleTrack returns a vehicle's points in the window and whether the
+// vehicle has any history at all.
+func vehicleTrack(vehicleID string, from, to int64) ([]processing.TrackPoint, bool) {
+	vehicleHistoryMu.RLock()
+	defer vehicleHistoryMu.RUnlock()
+
+	ring, found := vehicleHistory[vehicleID]
+	if !found {
+		return nil, false
+	}
+	return ring.window(from, to), true
+}
+
+// tripTrack returns the points of every vehicle that ran the trip in the
+// window, oldest first.
+func tripTrack(tripID string, from, to int64) []processing.TrackPoint {
+	vehicleHistoryMu.RLock()
+	defer vehicleHistoryMu.RUnlock()
+
+	var points []processing.TrackPoint
+	for _, ring := range vehicleHistory {
+		for _, p := range ring.window(from, to) {
+			if p.TripID == tripID {
+				points = append(points, p)
+			}
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp < points[j].Timestamp
+	})
+	return points
+}
+
+// parseTrackWindow reads ?from= and ?to= as unix seconds or RFC3339. The
+// window ends now and spans an hour by default.
+func parseTrackWindow(fromValue, toValue string) (int64, int64, error) {
+	to, err := parseRequestTime(toValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("to must be unix seconds or RFC3339")
+	}
+	from := to.Add(-defaultTrackWindow)
+	if fromValue != "" {
+		if from, err = parseRequestTime(fromValue); err != nil {
+			return 0, 0, fmt.Errorf("from must be unix seconds or RFC3339")
+		}
+	}
+	if from.After(to) {
+		return 0, 0, fmt.Errorf("from must not be after to")
+	}
+	return from.Unix(), to.Unix(), nil
+}
+
+// trackFeatures draws one LineString per vehicle, with the time of each
+// vertex in the timestamps property.
+func trackFeatures(points []processing.TrackPoint) []processing.Feature {
+	byVehicle := make(map[string][]processing.TrackPoint)
+	var order []string
+	for _, p := range points {
+		if _, seen := byVehicle[p.VehicleID]; !seen {
+			order = append(order, p.VehicleID)
+		}
+		byVehicle[p.VehicleID] = append(byVehicle[p.VehicleID], p)
+	}
+
+	features := make([]processing.Feature, 0, len(order))
+	for _, vehicleID := range order {
+		track := byVehicle[vehicleID]
+		coordinates := make([][]float64, 0, len(track))
+		timestamps := make([]int64, 0, len(track))
+		tripIDs := []string{}
+		for _, p := range track {
+			coordinates = append(coordinates, []float64{p.Longitude, p.Latitude})
+			timestamps = append(timestamps, p.Timestamp)
+			if len(tripIDs) == 0 || tripIDs[len(tripIDs)-1] != p.TripID {
+				tripIDs = append(tripIDs, p.TripID)
+			}
+		}
+		geometry := processing.Geometry{Type: "LineString", Coordinates: coordinates}
+		if len(coordinates) == 1 {
+			geometry = processing.Geometry{Type: "Point", Coordinates: coordinates[0]}
+		}
+		features = append(features, processing.Feature{
+			Type:     "Feature",
+			ID:       vehicleID,
+			Geometry: geometry,
+			Properties: map[string]interface{}{
+				"vehicle_id": vehicleID,
+				"trip_ids":   tripIDs,
+				"timestamps": timestamps,
+			},
+		})
+	}
+	return features
+}
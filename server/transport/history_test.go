@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistTrackPointsPrunesExpiredDays(t *testing.T) {
+	dir, retention := history.dir, history.retention
+	history.dir, history.retention = t.TempDir(), defaultHistoryRetention
+	t.Cleanup(func() {
+		CloseVehicleHistory()
+		history.dir, history.retention = dir, retention
+	})
+
+	expired := filepath.Join(history.dir, historyFilePrefix+"20200101"+historyFileSuffix)
+	if err := os.WriteFile(expired, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	vehicleHistoryMu.Lock()
+	err := persistTrackPoints([]processing.TrackPoint{{VehicleID: "bus1", Timestamp: clockNow().Unix()}})
+	vehicleHistoryMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired day file was kept")
+	}
+	current := filepath.Join(history.dir, historyFilePrefix+clockNow().In(AgencyLocation).Format(serviceDateLayout)+historyFileSuffix)
+	CloseVehicleHistory()
+	if data, err := os.ReadFile(current); err != nil || len(data) == 0 {
+		t.Errorf("current day file not written: %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"math"
+	"sort"
+)
+
+// An isochrone runs RAPTOR from the origin to every stop instead of to a
+// destination, then draws the area a rider can still walk to from each stop
+// with the time left. The walking circles are rasterised onto a grid in
+// local meters and the outline of the covered cells becomes the polygon.
+
+const (
+	defaultIsochroneMinutes = 30
+	maxIsochroneMinutes     = 120
+	isochroneCellMeters     = 100.0
+	maxIsochroneCells       = 250000
+	metersPerDegreeLat      = 111320.0
+)
+
+type walkCircle struct {
+	lat    float64
+	lon    float64
+	radius float64
+}
+
+type latticePoint struct {
+	x, y int
+}
+
+type latticeEdge struct {
+	from, to latticePoint
+}
+
+// isochrone returns the stops reachable within budget seconds of the query
+// departure, soonest first, and the area reachable on foot from them.
+func (q *planQuery) isochrone(budget int, walkRadius float64) ([]processing.ReachableStop, processing.Geometry) {
+	start := int(q.departure.Sub(q.dayStart).Seconds())
+	limit := start + budget
+	q.horizon = limit + 1
+	state := q.raptor()
+
+	walkable := func(seconds int) float64 {
+		return math.Min(walkableDistance(seconds), walkRadius)
+	}
+
+	var circles []walkCircle
+	if q.origin.place.StopID == "" {
+		circles = append(circles, walkCircle{lat: q.origin.place.Lat, lon: q.origin.place.Lon, radius: walkable(budget)})
+	}
+
+	stops := []processing.ReachableStop{}
+	for idx, arrival := range state.best {
+		if arrival > limit {
+			continue
+		}
+		stop, ok := findStopById(plannerStops[idx])
+		if !ok {
+			continue
+		}
+
+		round := 0
+		for round < len(state.tau) && state.tau[round][idx] != arrival {
+			round++
+		}
+		transfers := 0
+		if round > 1 {
+			transfers = round - 1
+		}
+
+		stops = append(stops, processing.ReachableStop{
+			Stop:        stop,
+			ArrivalTime: q.unix(arrival),
+			TravelTime:  int64(arrival - start),
+			Transfers:   transfers,
+		})
+		circles = append(circles, walkCircle{lat: stop.StopLat, lon: stop.StopLon, radius: walkable(limit - arrival)})
+	}
+
+	sort.Slice(stops, func(i, j int) bool {
+		if stops[i].TravelTime != stops[j].TravelTime {
+			return stops[i].TravelTime < stops[j].TravelTime
+		}
+		return stops[i].StopID < stops[j].StopID
+	})
+	return stops, isochroneGeometry(circles)
+}
+
+// isochroneGeometry outlines the union of the circles. A single area comes
+// back as a Polygon, several as a MultiPolygon, each with its holes.
+func isochroneGeometry(circles []walkCircle) processing.Geometry {
+	if len(circles) == 0 {
+		return processing.Geometry{Type: "MultiPolygon", Coordinates: [][][][]float64{}}
+	}
+
+	minLat, minLon := math.Inf(1), math.Inf(1)
+	maxLat, maxLon := math.Inf(-1), math.Inf(-1)
+	for _, c := range circles {
+		minLat = math.Min(minLat, c.lat)
+		maxLat = math.Max(maxLat, c.lat)
+		minLon = math.Min(minLon, c.lon)
+		maxLon = math.Max(maxLon, c.lon)
+	}
+	metersPerDegreeLon := metersPerDegreeLat * math.Cos((minLat+maxLat)/2*math.Pi/180)
+
+	// pad by the largest radius so every circle fits inside the grid
+	pad := 0.0
+	for _, c := range circles {
+		pad = math.Max(pad, c.radius)
+	}
+	pad += isochroneCellMeters
+	minLat -= pad / metersPerDegreeLat
+	minLon -= pad / metersPerDegreeLon
+	width := (maxLon-minLon)*metersPerDegreeLon + pad
+	height := (maxLat-minLat)*metersPerDegreeLat + pad
+
+	cell := isochroneCellMeters
+	cols, rows := int(math.Ceil(width/cell)), int(math.Ceil(height/cell))
+	for cols*rows > maxIsochroneCells {
+		cell *= 2
+		cols, rows = int(math.Ceil(width/cell)), int(math.Ceil(height/cell))
+	}
+
+	covered := make([]bool, cols*rows)
+	for _, c := range circles {
+		cx := (c.lon - minLon) * metersPerDegreeLon
+		cy := (c.lat - minLat) * metersPerDegreeLat
+		x0, x1 := max(int((cx-c.radius)/cell), 0), min(int((cx+c.radius)/cell), cols-1)
+		y0, y1 := max(int((cy-c.radius)/cell), 0), min(int((cy+c.radius)/cell), rows-1)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				dx := (float64(x)+0.5)*cell - cx
+				dy := (float64(y)+0.5)*cell - cy
+				if dx*dx+dy*dy <= c.radius*c.radius {
+					covered[y*cols+x] = true
+				}
+			}
+		}
+	}
+
+	toPosition := func(p latticePoint) []float64 {
+		return []float64{
+			minLon + float64(p.x)*cell/metersPerDegreeLon,
+			minLat + float64(p.y)*cell/metersPerDegreeLat,
+		}
+	}
+	toRing := func(points []latticePoint) [][]float64 {
+		ring := make([][]float64, 0, len(points)+1)
+		for _, p := range points {
+			ring = append(ring, toPosition(p))
+		}
+		return append(ring, toPosition(points[0]))
+	}
+
+	var outers, holes [][]latticePoint
+	var holeInside [][2]float64
+	for _, ring := range traceRings(covered, cols, rows) {
+		if ringArea(ring.points) > 0 {
+			outers = append(outers, ring.points)
+			continue
+		}
+		holes = append(holes, ring.points)
+		// the covered cell to the left of the hole's first edge is inside
+		// the outer ring that owns the hole
+		d := latticePoint{ring.first.to.x - ring.first.from.x, ring.first.to.y - ring.first.from.y}
+		holeInside = append(holeInside, [2]float64{
+			float64(ring.first.from.x+ring.first.to.x)/2 - 0.5*float64(d.y),
+			float64(ring.first.from.y+ring.first.to.y)/2 + 0.5*float64(d.x),
+		})
+	}
+
+	polygons := make([][][][]float64, len(outers))
+	for i, outer := range outers {
+		polygons[i] = [][][]float64{toRing(outer)}
+	}
+	// outer rings can nest, an island inside a hole inside an area, so a
+	// hole belongs to the smallest outer ring around it
+	for i, hole := range holes {
+		owner, ownerArea := -1, 0
+		for j, outer := range outers {
+			area := ringArea(outer)
+			if (owner < 0 || area < ownerArea) && containsPoint(outer, holeInside[i][0], holeInside[i][1]) {
+				owner, ownerArea = j, area
+			}
+		}
+		if owner >= 0 {
+			polygons[owner] = append(polygons[owner], toRing(hole))
+		}
+	}
+
+	if len(polygons) == 1 {
+		return processing.Geometry{Type: "Polygon", Coordinates: polygons[0]}
+	}
+	return processing.Geometry{Type: "MultiPolygon", Coordinates: polygons}
+}
+
+type tracedRing struct {
+	points []latticePoint
+	first  latticeEdge
+}
+
+// traceRings follows the boundary between covered and empty cells. Edges
+// keep the covered cell on their left, so outer rings run counterclockwise
+// and holes clockwise as GeoJSON expects. Where two cells touch only at a
+// corner the left turn is taken, which keeps them in separate rings.
+func traceRings(covered []bool, cols, rows int) []tracedRing {
+	at := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < cols && y < rows && covered[y*cols+x]
+	}
+
+	var edges []latticeEdge
+	outgoing := make(map[latticePoint][]latticePoint)
+	emit := func(from, to latticePoint) {
+		edges = append(edges, latticeEdge{from, to})
+		outgoing[from] = append(outgoing[from], to)
+	}
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			if !at(x, y) {
+				continue
+			}
+			if !at(x, y-1) {
+				emit(latticePoint{x, y}, latticePoint{x + 1, y})
+			}
+			if !at(x+1, y) {
+				emit(latticePoint{x + 1, y}, latticePoint{x + 1, y + 1})
+			}
+			if !at(x, y+1) {
+				emit(latticePoint{x + 1, y + 1}, latticePoint{x, y + 1})
+			}
+			if !at(x-1, y) {
+				emit(latticePoint{x, y + 1}, latticePoint{x, y})
+			}
+		}
+	}
+
+	next := func(e latticeEdge) latticeEdge {
+		dx, dy := e.to.x-e.from.x, e.to.y-e.from.y
+		for _, turn := range [][2]int{{-dy, dx}, {dx, dy}, {dy, -dx}} {
+			candidate := latticePoint{e.to.x + turn[0], e.to.y + turn[1]}
+			for _, to := range outgoing[e.to] {
+				if to == candidate {
+					return latticeEdge{e.to, to}
+				}
+			}
+		}
+		return latticeEdge{e.to, e.from}
+	}
+
+	used := make(map[latticeEdge]bool, len(edges))
+	var rings []tracedRing
+	for _, first := range edges {
+		if used[first] {
+			continue
+		}
+		var points []latticePoint
+		for e := first; ; {
+			used[e] = true
+			points = append(points, e.from)
+			if e = next(e); e == first || used[e] {
+				break
+			}
+		}
+		rings = append(rings, tracedRing{points: dropCollinear(points), first: first})
+	}
+	return rings
+}
+
+// dropCollinear removes the vertices in the middle of straight runs.
+func dropCollinear(points []latticePoint) []latticePoint {
+	n := len(points)
+	kept := make([]latticePoint, 0, n)
+	for i, p := range points {
+		prev, next := points[(i+n-1)%n], points[(i+1)%n]
+		if (p.x-prev.x)*(next.y-p.y)-(p.y-prev.y)*(next.x-p.x) != 0 {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// ringArea is the signed shoelace area, positive for counterclockwise rings.
+func ringArea(points []latticePoint) int {
+	area := 0
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		area += p.x*q.y - q.x*p.y
+	}
+	return area
+}
+
+// containsPoint is the even-odd test. Test points sit on cell centres, so
+// they never fall on a ring's lattice edges.
+func containsPoint(ring []latticePoint, x, y float64) bool {
+	inside := false
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		py, qy := float64(p.y), float64(q.y)
+		if (py > y) != (qy > y) {
+			crossX := float64(p.x) + (y-py)/(qy-py)*float64(q.x-p.x)
+			if x < crossX {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
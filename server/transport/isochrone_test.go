@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"math"
+	"testing"
+)
+
+// circleRing places circles of the given radius on a ring around a point,
+// close enough to overlap into an annulus.
+func circleRing(lat, lon, ringMeters, radius float64) []walkCircle {
+	count := int(math.Ceil(2 * math.Pi * ringMeters / radius))
+	var circles []walkCircle
+	for i := 0; i < count; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(count)
+		circles = append(circles, walkCircle{
+			lat:    lat + ringMeters*math.Sin(angle)/metersPerDegreeLat,
+			lon:    lon + ringMeters*math.Cos(angle)/(metersPerDegreeLat*math.Cos(lat*math.Pi/180)),
+			radius: radius,
+		})
+	}
+	return circles
+}
+
+func TestIsochroneGeometryNestedRings(t *testing.T) {
+	// an annulus with a smaller annulus inside its hole: each outer ring
+	// must own exactly the hole directly inside it
+	circles := append(circleRing(39.74, -104.99, 2500, 200), circleRing(39.74, -104.99, 1000, 200)...)
+
+	geometry := isochroneGeometry(circles)
+	polygons, ok := geometry.Coordinates.([][][][]float64)
+	if geometry.Type != "MultiPolygon" || !ok || len(polygons) != 2 {
+		t.Fatalf("got a %s with %d polygons, want a MultiPolygon of 2", geometry.Type, len(polygons))
+	}
+	for i, polygon := range polygons {
+		if len(polygon) != 2 {
+			t.Errorf("polygon %d has %d holes, want 1", i, len(polygon)-1)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+var RoutePatternsMap = make(map[string][]processing.StopPattern) // route_id -> patterns, most trips first
+var TripPatternMap = make(map[string]string)                     // trip_id -> pattern_id
+
+// InitPatterns groups every trip by route, direction and exact stop sequence.
+// It needs trips, stop times and stops to be loaded first.
+func InitPatterns() {
+	type patternKey struct {
+		routeID     string
+		directionID int
+		stops       string
+	}
+	type patternAcc struct {
+		stopIDs   []string
+		tripIDs   []string
+		headsigns map[string]int
+		shapes    map[string]int
+	}
+
+	groups := make(map[patternKey]*patternAcc)
+	for _, trip := range TripsMap {
+		stopTimes, found := findStopTimesByTripID(trip.TripID)
+		if !found || len(stopTimes) == 0 {
+			continue
+		}
+
+		stopIDs := make([]string, len(stopTimes))
+		for i, st := range stopTimes {
+			stopIDs[i] = st.StopID
+		}
+
+		key := patternKey{routeID: trip.RouteID, directionID: trip.DirectionID, stops: strings.Join(stopIDs, ",")}
+		acc, ok := groups[key]
+		if !ok {
+			acc = &patternAcc{stopIDs: stopIDs, headsigns: make(map[string]int), shapes: make(map[string]int)}
+			groups[key] = acc
+		}
+		acc.tripIDs = append(acc.tripIDs, trip.TripID)
+		acc.headsigns[trip.TripHeadsign]++
+		if trip.ShapeID != "" {
+			acc.shapes[trip.ShapeID]++
+		}
+	}
+
+	byRoute := make(map[string][]*patternAcc)
+	keys := make(map[*patternAcc]patternKey)
+	for key, acc := range groups {
+		byRoute[key.routeID] = append(byRoute[key.routeID], acc)
+		keys[acc] = key
+	}
+
+	for routeID, accs := range byRoute {
+		sort.Slice(accs, func(i, j int) bool {
+			a, b := keys[accs[i]], keys[accs[j]]
+			if a.directionID != b.directionID {
+				return a.directionID < b.directionID
+			}
+			if len(accs[i].tripIDs) != len(accs[j].tripIDs) {
+				return len(accs[i].tripIDs) > len(accs[j].tripIDs)
+			}
+			return a.stops < b.stops
+		})
+
+		patterns := make([]processing.StopPattern, 0, len(accs))
+		for _, acc := range accs {
+			key := keys[acc]
+			pattern := processing.StopPattern{
+				PatternID:   patternID(key.routeID, key.directionID, key.stops),
+				RouteID:     routeID,
+				DirectionID: key.directionID,
+				TripCount:   len(acc.tripIDs),
+				Headsigns:   rankedKeys(acc.headsigns),
+				Stops:       make([]processing.PatternStop, 0, len(acc.stopIDs)),
+			}
+			if shapes := rankedKeys(acc.shapes); len(shapes) > 0 {
+				pattern.ShapeID = shapes[0]
+			}
+			for _, stopID := range acc.stopIDs {
+				ps := processing.PatternStop{StopID: stopID}
+				if stop, ok := findStopById(stopID); ok {
+					ps.StopName = stop.StopName
+					ps.StopLat = stop.StopLat
+					ps.StopLon = stop.StopLon
+				}
+				pattern.Stops = append(pattern.Stops, ps)
+			}
+			for _, tripID := range acc.tripIDs {
+				TripPatternMap[tripID] = pattern.PatternID
+			}
+			patterns = append(patterns, pattern)
+		}
+		RoutePatternsMap[routeID] = patterns
+	}
+
+	fmt.Printf("RoutePatternsMap initialized with %d patterns across %d routes\n", len(groups), len(RoutePatternsMap))
+}
+
+// patternID derives the id from the stop sequence itself, so it stays the
+// same when other patterns of the route are added, removed or reordered.
+func patternID(routeID string, directionID int, stops string) string {
+	h := fnv.New32a()
+	h.Write([]byte(stops))
+	return fmt.Sprintf("%s:%d:%08x", routeID, directionID, h.Sum32())
+}
+
+// mergeStopSequences combines several stop sequences into one ordering that
+// preserves the relative order of every input, so short turns and branches
+// line up with the full pattern. Stops visited twice keep both positions.
+func mergeStopSequences(sequences [][]string) []string {
+	var merged []string
+	for _, sequence := range sequences {
+		pos := 0
+		for _, stopID := range sequence {
+			if idx := indexFrom(merged, stopID, pos); idx >= 0 {
+				pos = idx + 1
+				continue
+			}
+			merged = append(merged, "")
+			copy(merged[pos+1:], merged[pos:])
+			merged[pos] = stopID
+			pos++
+		}
+	}
+	return merged
+}
+
+// indexFrom returns the first index at or after pos holding value, or -1.
+func indexFrom(values []string, value string, pos int) int {
+	for i := pos; i < len(values); i++ {
+		if values[i] == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// rankedKeys orders keys by descending count, breaking ties alphabetically.
+func rankedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func findPatternsByRouteID(routeId string) ([]processing.StopPattern, bool) {
+	patterns, found := RoutePatternsMap[routeId]
+	return patterns, found
+}
@@ -0,0 +1,732 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// Journey planning uses RAPTOR (Delling, Pajor, Werneck: Round-Based Public
+// Transit Routing). Each round k finds the earliest arrival at every stop
+// using at most k vehicles, which yields the Pareto set of arrival time
+// versus number of transfers without any outside service.
+
+const (
+	maxPlannerRides     = 6
+	defaultMaxTransfers = 3
+	minTransferSeconds  = 60
+	defaultAccessRadius = 800.0
+	maxAccessRadius     = 2000.0
+	transferRiskSeconds = 120
+	unreachable         = math.MaxInt32
+)
+
+const (
+	labelNone = iota
+	labelAccess
+	labelRide
+	labelWalk
+)
+
+type plannerTrip struct {
+	tripID     string
+	serviceID  string
+	headsign   string
+	wheelchair int
+	sequences  []int
+	arrivals   []int
+	departures []int
+	pickup     []bool
+	dropOff    []bool
+}
+
+type plannerPattern struct {
+	patternID string
+	routeID   string
+	stops     []int
+	trips     []plannerTrip // ordered by departure from the first stop
+}
+
+type patternRef struct {
+	pattern int
+	pos     int
+}
+
+var plannerStops []string
+var plannerStopIndex = make(map[string]int)
+var plannerStopWheelchair []int
+var plannerPatterns []plannerPattern
+var plannerStopPatterns [][]patternRef
+var plannerTransfers [][]footpath
+
+// InitPlanner converts the stop patterns and walking transfers into the flat
+// arrays RAPTOR scans. It must run after InitPatterns and InitTransfers.
+func InitPlanner() {
+	for stopID := range StopsMap {
+		plannerStops = append(plannerStops, stopID)
+	}
+	sort.Strings(plannerStops)
+	plannerStopWheelchair = make([]int, len(plannerStops))
+	for i, stopID := range plannerStops {
+		plannerStopIndex[stopID] = i
+		plannerStopWheelchair[i] = stopWheelchairBoarding(StopsMap[stopID])
+	}
+	plannerStopPatterns = make([][]patternRef, len(plannerStops))
+
+	plannerTransfers = make([][]footpath, len(plannerStops))
+	for i, stopID := range plannerStops {
+		transfers, _ := findTransfersByStopID(stopID)
+		for _, transfer := range transfers {
+			if to, ok := plannerStopIndex[transfer.ToStopID]; ok {
+				plannerTransfers[i] = append(plannerTransfers[i], footpath{to: to, seconds: transfer.WalkingTime, distance: transfer.Distance})
+			}
+		}
+	}
+
+	patternTrips := make(map[string][]string)
+	for tripID, patternID := range TripPatternMap {
+		patternTrips[patternID] = append(patternTrips[patternID], tripID)
+	}
+
+	for _, patterns := range RoutePatternsMap {
+		for _, pattern := range patterns {
+			pp := plannerPattern{patternID: pattern.PatternID, routeID: pattern.RouteID}
+
+			complete := true
+			for _, stop := range pattern.Stops {
+				idx, ok := plannerStopIndex[stop.StopID]
+				if !ok {
+					complete = false
+					break
+				}
+				pp.stops = append(pp.stops, idx)
+			}
+			if !complete {
+				continue
+			}
+
+			for _, tripID := range patternTrips[pattern.PatternID] {
+				trip, _ := findTripByID(tripID)
+				stopTimes, _ := findStopTimesByTripID(tripID)
+				pt := plannerTrip{
+					tripID:     tripID,
+					serviceID:  trip.ServiceID,
+					headsign:   trip.TripHeadsign,
+					wheelchair: trip.WheelchairAccessible,
+					sequences:  make([]int, len(stopTimes)),
+					arrivals:   make([]int, len(stopTimes)),
+					departures: make([]int, len(stopTimes)),
+					pickup:     make([]bool, len(stopTimes)),
+					dropOff:    make([]bool, len(stopTimes)),
+				}
+				valid := true
+				for i, st := range stopTimes {
+					arr, errArr := processing.ParseGTFSTime(st.ArrivalTime)
+					dep, errDep := processing.ParseGTFSTime(st.DepartureTime)
+					if errArr != nil || errDep != nil {
+						valid = false
+						break
+					}
+					pt.sequences[i] = st.StopSequence
+					pt.arrivals[i] = arr
+					pt.departures[i] = dep
+					pt.pickup[i] = st.PickupType != 1
+					pt.dropOff[i] = st.DropOffType != 1
+				}
+				if valid {
+					pp.trips = append(pp.trips, pt)
+				}
+			}
+			if len(pp.trips) == 0 {
+				continue
+			}
+			sort.Slice(pp.trips, func(i, j int) bool {
+				return pp.trips[i].departures[0] < pp.trips[j].departures[0]
+			})
+
+			idx := len(plannerPatterns)
+			plannerPatterns = append(plannerPatterns, pp)
+			for pos, stop := range pp.stops {
+				plannerStopPatterns[stop] = append(plannerStopPatterns[stop], patternRef{pattern: idx, pos: pos})
+			}
+		}
+	}
+
+	fmt.Printf("Planner initialized with %d stops and %d patterns\n", len(plannerStops), len(plannerPatterns))
+}
+
+// activeTrip is a trip running on a specific service date. offset shifts
+// its schedule onto the query day's clock. When realtime is set, trip holds
+// the predicted times and scheduled the timetable they replace.
+type activeTrip struct {
+	trip        *plannerTrip
+	scheduled   *plannerTrip
+	offset      int
+	serviceDate string
+	realtime    bool
+}
+
+func (t *activeTrip) departure(pos int) int {
+	return t.trip.departures[pos] + t.offset
+}
+
+func (t *activeTrip) arrival(pos int) int {
+	return t.trip.arrivals[pos] + t.offset
+}
+
+type plannerLabel struct {
+	kind      int
+	round     int
+	from      int
+	arrival   int
+	pattern   int
+	trip      *activeTrip
+	boardPos  int
+	alightPos int
+	walk      int
+	distance  float64
+}
+
+type footpath struct {
+	to       int
+	seconds  int
+	distance float64
+}
+
+// planEndpoint is an origin or destination: the place itself plus the stops
+// reachable from it on foot with their walking times.
+type planEndpoint struct {
+	place     processing.Place
+	stops     map[int]int
+	distances map[int]float64
+}
+
+type planQuery struct {
+	origin       planEndpoint
+	destination  planEndpoint
+	departure    time.Time
+	maxRides     int
+	dayStart     time.Time
+	serviceDays  []time.Time
+	active       map[int][]activeTrip
+	activeByDate map[string]map[string]bool
+	tripUpdates  map[string][]*gtfs.TripUpdate
+	wheelchair   wheelchairFilter
+	horizon      int // arrivals at or after this are pruned, on the query clock
+}
+
+// parsePlanEndpoint accepts either "lat,lon" or a stop_id. Stops the
+// wheelchair filter rules out are not used to enter or leave the network.
+func parsePlanEndpoint(value string, radius float64, wheelchair wheelchairFilter) (planEndpoint, error) {
+	endpoint := planEndpoint{stops: make(map[int]int), distances: make(map[int]float64)}
+
+	if lat, lon, ok := parseLatLon(value); ok {
+		endpoint.place = processing.Place{Name: fmt.Sprintf("%.6f,%.6f", lat, lon), Lat: lat, Lon: lon}
+		for _, p := range StopsIndex.nearby(lat, lon, radius) {
+			if idx, ok := plannerStopIndex[p.id]; ok && wheelchair.allows(plannerStopWheelchair[idx]) {
+				distance := haversineMeters(lat, lon, p.lat, p.lon)
+				endpoint.stops[idx] = walkSeconds(distance)
+				endpoint.distances[idx] = distance
+			}
+		}
+		if len(endpoint.stops) == 0 {
+			return endpoint, fmt.Errorf("no stops within %.0f meters of %s", radius, value)
+		}
+		return endpoint, nil
+	}
+
+	idx, ok := plannerStopIndex[value]
+	if !ok {
+		return endpoint, fmt.Errorf("stop %s not found", value)
+	}
+	if !wheelchair.allows(plannerStopWheelchair[idx]) {
+		return endpoint, fmt.Errorf("stop %s is not known to be wheelchair accessible", value)
+	}
+	endpoint.place = stopPlace(idx)
+	endpoint.stops[idx] = 0
+	endpoint.distances[idx] = 0
+	return endpoint, nil
+}
+
+func parseLatLon(value string) (float64, float64, bool) {
+	latText, lonText, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	lon, errLon := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+	if errLat != nil || errLon != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+func stopPlace(idx int) processing.Place {
+	stopID := plannerStops[idx]
+	place := processing.Place{StopID: stopID, Accessibility: wheelchairLabel(plannerStopWheelchair[idx])}
+	if stop, ok := findStopById(stopID); ok {
+		place.Name = stop.StopName
+		place.Lat = stop.StopLat
+		place.Lon = stop.StopLon
+	}
+	return place
+}
+
+func newPlanQuery(origin, destination planEndpoint, departure time.Time, maxTransfers int) *planQuery {
+	local := departure.In(AgencyLocation)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, AgencyLocation)
+
+	maxRides := maxTransfers + 1
+	if maxRides > maxPlannerRides {
+		maxRides = maxPlannerRides
+	}
+
+	return &planQuery{
+		origin:       origin,
+		destination:  destination,
+		departure:    departure,
+		maxRides:     maxRides,
+		dayStart:     serviceDayStart(today),
+		serviceDays:  []time.Time{today.AddDate(0, 0, -1), today, today.AddDate(0, 0, 1)},
+		active:       make(map[int][]activeTrip),
+		activeByDate: make(map[string]map[string]bool),
+		horizon:      unreachable,
+	}
+}
+
+// activeTrips returns the trips of a pattern running on the service days
+// around the query, on the query day's clock.
+func (q *planQuery) activeTrips(pattern int) []activeTrip {
+	if trips, ok := q.active[pattern]; ok {
+		return trips
+	}
+
+	var trips []activeTrip
+	for _, date := range q.serviceDays {
+		serviceDate := date.Format(serviceDateLayout)
+		services, ok := q.activeByDate[serviceDate]
+		if !ok {
+			services = activeServices(date)
+			q.activeByDate[serviceDate] = services
+		}
+		offset := int(serviceDayStart(date).Sub(q.dayStart).Seconds())
+		pp := &plannerPatterns[pattern]
+		for i := range pp.trips {
+			if !services[pp.trips[i].serviceID] || !q.wheelchair.allows(pp.trips[i].wheelchair) {
+				continue
+			}
+			t := activeTrip{trip: &pp.trips[i], scheduled: &pp.trips[i], offset: offset, serviceDate: serviceDate}
+			if tu := pickTripUpdate(q.tripUpdates[t.trip.tripID], serviceDate); tu != nil {
+				var running bool
+				if t, running = q.predictTrip(t, tu); !running {
+					continue
+				}
+			}
+			trips = append(trips, t)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].departure(0) < trips[j].departure(0)
+	})
+
+	q.active[pattern] = trips
+	return trips
+}
+
+// predictTrip applies a TripUpdate to a trip instance through the
+// prediction engine. It reports false when the trip is canceled. SKIPPED
+// stops can neither be boarded nor alighted at.
+func (q *planQuery) predictTrip(t activeTrip, tu *gtfs.TripUpdate) (activeTrip, bool) {
+	if startDate := tu.GetTrip().GetStartDate(); startDate != "" && startDate != t.serviceDate {
+		return t, true
+	}
+	if tu.GetTrip().GetScheduleRelationship() == gtfs.TripDescriptor_CANCELED {
+		return t, false
+	}
+	if len(tu.StopTimeUpdate) == 0 {
+		return t, true
+	}
+
+	scheduled := t.scheduled
+	dayStart := q.dayStart.Unix() + int64(t.offset)
+	predictedStops := predictStops(scheduled.tripID, scheduled.sequences, scheduled.arrivals, scheduled.departures, dayStart, tu)
+
+	predicted := &plannerTrip{
+		tripID:     scheduled.tripID,
+		serviceID:  scheduled.serviceID,
+		headsign:   scheduled.headsign,
+		wheelchair: scheduled.wheelchair,
+		sequences:  scheduled.sequences,
+		arrivals:   make([]int, len(predictedStops)),
+		departures: make([]int, len(predictedStops)),
+		pickup:     append([]bool(nil), scheduled.pickup...),
+		dropOff:    append([]bool(nil), scheduled.dropOff...),
+	}
+	for pos, p := range predictedStops {
+		predicted.arrivals[pos] = p.arrival
+		predicted.departures[pos] = p.departure
+		if p.skipped {
+			predicted.pickup[pos] = false
+			predicted.dropOff[pos] = false
+		}
+	}
+
+	t.trip = predicted
+	t.realtime = true
+	return t, true
+}
+
+// earliestTrip finds the first trip of the pattern that can be boarded at
+// pos no earlier than ready.
+func (q *planQuery) earliestTrip(pattern, pos, ready int) *activeTrip {
+	trips := q.activeTrips(pattern)
+	var best *activeTrip
+	for i := range trips {
+		t := &trips[i]
+		if !t.trip.pickup[pos] || t.departure(pos) < ready {
+			continue
+		}
+		if best == nil || t.departure(pos) < best.departure(pos) {
+			best = t
+		}
+		// trips are ordered by first departure, so once one leaves the
+		// first stop after our best leaves this stop nothing better follows
+		if best != nil && t.departure(0) > best.departure(pos) {
+			break
+		}
+	}
+	return best
+}
+
+// raptorState holds the per round earliest arrivals and the labels that
+// explain them, plus the best arrival at the destination for each round.
+type raptorState struct {
+	tau         [][]int
+	labels      [][]plannerLabel
+	best        []int
+	destArrival []int
+	destStop    []int
+}
+
+// plan runs RAPTOR and returns the Pareto optimal itineraries, fewest
+// transfers first.
+func (q *planQuery) plan() []processing.Itinerary {
+	state := q.raptor()
+
+	var itineraries []processing.Itinerary
+	last := unreachable
+	for k := range state.destArrival {
+		if state.destArrival[k] >= last || state.destStop[k] < 0 {
+			continue
+		}
+		last = state.destArrival[k]
+		itineraries = append(itineraries, q.reconstruct(state.labels, k, state.destStop[k]))
+	}
+	return itineraries
+}
+
+// raptor runs the rounds from the origin. Without a destination it labels
+// every stop reachable before the horizon.
+func (q *planQuery) raptor() *raptorState {
+	n := len(plannerStops)
+	rounds := q.maxRides + 1
+	start := int(q.departure.Sub(q.dayStart).Seconds())
+
+	tau := make([][]int, rounds)
+	labels := make([][]plannerLabel, rounds)
+	for k := range tau {
+		tau[k] = make([]int, n)
+		labels[k] = make([]plannerLabel, n)
+		for i := range tau[k] {
+			tau[k][i] = unreachable
+		}
+	}
+	best := make([]int, n)
+	for i := range best {
+		best[i] = unreachable
+	}
+
+	bestDest := q.horizon
+	destArrival := make([]int, rounds)
+	destStop := make([]int, rounds)
+	for k := range destArrival {
+		destArrival[k] = unreachable
+		destStop[k] = -1
+	}
+
+	updateDestination := func(k int) {
+		for stop, egress := range q.destination.stops {
+			if tau[k][stop] == unreachable {
+				continue
+			}
+			if arrival := tau[k][stop] + egress; arrival < destArrival[k] {
+				destArrival[k] = arrival
+				destStop[k] = stop
+			}
+		}
+		if destArrival[k] < bestDest {
+			bestDest = destArrival[k]
+		}
+	}
+
+	relaxFootpaths := func(k int, marked map[int]bool) {
+		improved := make(map[int]bool)
+		for stop := range marked {
+			for _, path := range plannerTransfers[stop] {
+				if !q.wheelchair.allows(plannerStopWheelchair[path.to]) {
+					continue
+				}
+				arrival := tau[k][stop] + path.seconds
+				if arrival >= best[path.to] || arrival >= bestDest {
+					continue
+				}
+				tau[k][path.to] = arrival
+				best[path.to] = arrival
+				labels[k][path.to] = plannerLabel{kind: labelWalk, round: k, from: stop, arrival: arrival, walk: path.seconds, distance: path.distance}
+				improved[path.to] = true
+			}
+		}
+		for stop := range improved {
+			marked[stop] = true
+		}
+	}
+
+	marked := make(map[int]bool)
+	for stop, access := range q.origin.stops {
+		arrival := start + access
+		tau[0][stop] = arrival
+		best[stop] = arrival
+		labels[0][stop] = plannerLabel{kind: labelAccess, round: 0, arrival: arrival, walk: access, distance: q.origin.distances[stop]}
+		marked[stop] = true
+	}
+	relaxFootpaths(0, marked)
+	updateDestination(0)
+
+	for k := 1; k < rounds && len(marked) > 0; k++ {
+		copy(tau[k], tau[k-1])
+		copy(labels[k], labels[k-1])
+
+		queue := make(map[int]int)
+		for stop := range marked {
+			for _, ref := range plannerStopPatterns[stop] {
+				if pos, ok := queue[ref.pattern]; !ok || ref.pos < pos {
+					queue[ref.pattern] = ref.pos
+				}
+			}
+		}
+		marked = make(map[int]bool)
+
+		for pattern, from := range queue {
+			stops := plannerPatterns[pattern].stops
+			var current *activeTrip
+			boardPos := -1
+
+			for pos := from; pos < len(stops); pos++ {
+				stop := stops[pos]
+				// the vehicle passes through, but nobody gets on or off here
+				if !q.wheelchair.allows(plannerStopWheelchair[stop]) {
+					continue
+				}
+
+				if current != nil && current.trip.dropOff[pos] {
+					arrival := current.arrival(pos)
+					if arrival < best[stop] && arrival < bestDest {
+						tau[k][stop] = arrival
+						best[stop] = arrival
+						labels[k][stop] = plannerLabel{
+							kind:      labelRide,
+							round:     k,
+							from:      stops[boardPos],
+							arrival:   arrival,
+							pattern:   pattern,
+							trip:      current,
+							boardPos:  boardPos,
+							alightPos: pos,
+						}
+						marked[stop] = true
+					}
+				}
+
+				previous := tau[k-1][stop]
+				if previous == unreachable {
+					continue
+				}
+				ready := previous
+				if labels[k-1][stop].kind != labelAccess {
+					ready += minTransferSeconds
+				}
+				if current == nil || ready < current.departure(pos) {
+					if t := q.earliestTrip(pattern, pos, ready); t != nil && (current == nil || t.departure(pos) < current.departure(pos)) {
+						current = t
+						boardPos = pos
+					}
+				}
+			}
+		}
+
+		relaxFootpaths(k, marked)
+		updateDestination(k)
+	}
+
+	return &raptorState{tau: tau, labels: labels, best: best, destArrival: destArrival, destStop: destStop}
+}
+
+// reconstruct walks the labels back from the destination stop to the origin.
+func (q *planQuery) reconstruct(labels [][]plannerLabel, round, stop int) processing.Itinerary {
+	var legs []processing.Leg
+
+	if egress := q.destination.stops[stop]; q.destination.place.StopID == "" {
+		arrival := labels[round][stop].arrival
+		legs = append(legs, processing.Leg{
+			Mode:      "WALK",
+			From:      stopPlace(stop),
+			To:        q.destination.place,
+			StartTime: q.unix(arrival),
+			EndTime:   q.unix(arrival + egress),
+			Distance:  q.destination.distances[stop],
+		})
+	}
+
+	for {
+		label := labels[round][stop]
+		switch label.kind {
+		case labelAccess:
+			if q.origin.place.StopID == "" {
+				legs = append(legs, processing.Leg{
+					Mode:      "WALK",
+					From:      q.origin.place,
+					To:        stopPlace(stop),
+					StartTime: q.unix(label.arrival - label.walk),
+					EndTime:   q.unix(label.arrival),
+					Distance:  label.distance,
+				})
+			}
+			return q.itinerary(legs)
+		case labelWalk:
+			legs = append(legs, processing.Leg{
+				Mode:      "WALK",
+				From:      stopPlace(label.from),
+				To:        stopPlace(stop),
+				StartTime: q.unix(label.arrival - label.walk),
+				EndTime:   q.unix(label.arrival),
+				Distance:  label.distance,
+			})
+			stop = label.from
+			round = label.round
+		case labelRide:
+			legs = append(legs, q.transitLeg(label))
+			stop = label.from
+			round = label.round - 1
+		default:
+			return q.itinerary(legs)
+		}
+	}
+}
+
+func (q *planQuery) transitLeg(label plannerLabel) processing.Leg {
+	pattern := plannerPatterns[label.pattern]
+	leg := processing.Leg{
+		Mode:          "TRANSIT",
+		From:          stopPlace(pattern.stops[label.boardPos]),
+		To:            stopPlace(pattern.stops[label.alightPos]),
+		StartTime:     q.unix(label.trip.departure(label.boardPos)),
+		EndTime:       q.unix(label.trip.arrival(label.alightPos)),
+		RouteID:       pattern.routeID,
+		TripID:        label.trip.trip.tripID,
+		Headsign:      label.trip.trip.headsign,
+		ServiceDate:   label.trip.serviceDate,
+		Realtime:      label.trip.realtime,
+		Accessibility: wheelchairLabel(label.trip.trip.wheelchair),
+	}
+	if label.trip.realtime {
+		leg.Delay = int64(label.trip.trip.departures[label.boardPos] - label.trip.scheduled.departures[label.boardPos])
+	}
+	if route, ok := findRouteByID(pattern.routeID); ok {
+		leg.RouteShortName = route.RouteShortName
+		leg.RouteColor = route.RouteColor
+	}
+	for pos := label.boardPos + 1; pos < label.alightPos; pos++ {
+		leg.IntermediateStops = append(leg.IntermediateStops, stopPlace(pattern.stops[pos]))
+	}
+	return leg
+}
+
+// itinerary reverses the collected legs and shifts walks before the first
+// ride so the rider leaves just in time to catch it. Each ride after the
+// first records the slack left once the walk to it is done, and a transfer
+// with less than transferRiskSeconds of it is flagged as at risk.
+func (q *planQuery) itinerary(reversed []processing.Leg) processing.Itinerary {
+	legs := make([]processing.Leg, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		legs = append(legs, reversed[i])
+	}
+
+	firstTransit := -1
+	for i, leg := range legs {
+		if leg.Mode == "TRANSIT" {
+			firstTransit = i
+			break
+		}
+	}
+	for i := firstTransit - 1; i >= 0; i-- {
+		duration := legs[i].EndTime - legs[i].StartTime
+		legs[i].EndTime = legs[i+1].StartTime
+		legs[i].StartTime = legs[i].EndTime - duration
+	}
+
+	itinerary := processing.Itinerary{Legs: legs, Transfers: -1}
+	if len(legs) == 0 {
+		itinerary.Transfers = 0
+		itinerary.DepartureTime = q.departure.Unix()
+		itinerary.ArrivalTime = q.departure.Unix()
+		itinerary.Accessibility = wheelchairLabel(combineWheelchair())
+		return itinerary
+	}
+	itinerary.DepartureTime = legs[0].StartTime
+	itinerary.ArrivalTime = legs[len(legs)-1].EndTime
+	itinerary.Duration = itinerary.ArrivalTime - itinerary.DepartureTime
+	var wheelchair []int
+	previousArrival, walking := int64(-1), int64(0)
+	for i := range legs {
+		leg := &legs[i]
+		if leg.Mode != "TRANSIT" {
+			itinerary.WalkingSeconds += leg.EndTime - leg.StartTime
+			walking += leg.EndTime - leg.StartTime
+			continue
+		}
+		itinerary.Transfers++
+		if trip, ok := findTripByID(leg.TripID); ok {
+			wheelchair = append(wheelchair, trip.WheelchairAccessible)
+		}
+		wheelchair = append(wheelchair,
+			plannerStopWheelchair[plannerStopIndex[leg.From.StopID]],
+			plannerStopWheelchair[plannerStopIndex[leg.To.StopID]])
+		if leg.Realtime {
+			itinerary.Realtime = true
+		}
+		if previousArrival >= 0 {
+			slack := leg.StartTime - previousArrival - walking
+			leg.TransferSlack = &slack
+			if slack < transferRiskSeconds {
+				leg.TransferAtRisk = true
+				itinerary.AtRisk = true
+			}
+		}
+		previousArrival, walking = leg.EndTime, 0
+	}
+	if itinerary.Transfers < 0 {
+		itinerary.Transfers = 0
+	}
+	itinerary.Accessibility = wheelchairLabel(combineWheelchair(wheelchair...))
+	return itinerary
+}
+
+func (q *planQuery) unix(seconds int) int64 {
+	return q.dayStart.Unix() + int64(seconds)
+}
@@ -0,0 +1,217 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+)
+
+// Each GTFS-RT feed is downloaded by one background poller and every
+// request reads the latest decoded snapshot, so upstream traffic no longer
+// grows with the number of clients.
+
+const defaultPollInterval = 30 * time.Second
+
+type feedSnapshot struct {
+	feed      *gtfs.FeedMessage
+	fetchedAt time.Time
+
+	indexOnce sync.Once
+	indexed   *snapshotIndex
+}
+
+// age is how long ago the snapshot was downloaded.
+func (s *feedSnapshot) age() time.Duration {
+	return clockNow().Sub(s.fetchedAt)
+}
+
+// timestamp is the producer's header timestamp, zero when it is missing.
+func (s *feedSnapshot) timestamp() time.Time {
+	if ts := s.feed.GetHeader().GetTimestamp(); ts != 0 {
+		return time.Unix(int64(ts), 0)
+	}
+	return time.Time{}
+}
+
+type feedPoller struct {
+	name     string
+	envVar   string
+	fetch    func() (*gtfs.FeedMessage, error)
+	interval time.Duration
+	onUpdate func(*feedSnapshot) // called when a download brings a new feed
+	refresh  chan struct{}       // asks run for a poll ahead of the ticker
+
+	mu       sync.RWMutex
+	snapshot *feedSnapshot
+	lastErr  error
+	started  bool
+}
+
+var alertsPoller = &feedPoller{name: "Alerts", envVar: "ALERTS_POLL_INTERVAL", fetch: FetchAlerts, interval: defaultPollInterval, refresh: make(chan struct{}, 1)}
+var tripUpdatesPoller = &feedPoller{name: "TripUpdates", envVar: "TRIP_UPDATES_POLL_INTERVAL", fetch: FetchTripUpdates, interval: defaultPollInterval, refresh: make(chan struct{}, 1)}
+var vehiclePositionsPoller = &feedPoller{name: "VehiclePositions", envVar: "VEHICLE_POSITIONS_POLL_INTERVAL", fetch: FetchVehiclePosition, interval: defaultPollInterval, refresh: make(chan struct{}, 1), onUpdate: vehiclePositionsUpdated}
+
+var feedPollers = []*feedPoller{alertsPoller, tripUpdatesPoller, vehiclePositionsPoller}
+
+// OnVehiclePositions is called with the vehicles of every new
+// VehiclePositions feed and the feed's header timestamp.
+var OnVehiclePositions func(timestamp int64, vehicles []processing.VehiclePositionEntity)
+
+func vehiclePositionsUpdated(snapshot *feedSnapshot) {
+	recordVehiclePositions(snapshot)
+	publishVehiclePositions(snapshot)
+}
+
+func publishVehiclePositions(snapshot *feedSnapshot) {
+	if OnVehiclePositions != nil {
+		OnVehiclePositions(int64(snapshot.feed.GetHeader().GetTimestamp()), convertVehiclePositions(snapshot.feed.Entity, false))
+	}
+}
+
+// StartRealtimePollers starts one poller per feed. GTFSRT_POLL_INTERVAL sets
+// the interval for all of them and ALERTS_POLL_INTERVAL,
+// TRIP_UPDATES_POLL_INTERVAL and VEHICLE_POSITIONS_POLL_INTERVAL override it
+// per feed. Values are durations such as "15s" or a number of seconds.
+// A replay polls every second by default to keep up with its clock.
+func StartRealtimePollers() {
+	fallback := defaultPollInterval
+	if replaying() {
+		fallback = replayPollInterval
+	}
+	shared := parsePollInterval("GTFSRT_POLL_INTERVAL", fallback)
+	for _, p := range feedPollers {
+		p.mu.Lock()
+		p.interval = parsePollInterval(p.envVar, shared)
+		p.started = true
+		p.mu.Unlock()
+
+		fmt.Printf("Polling %s every %s\n", p.name, p.interval)
+		go p.run()
+	}
+}
+
+func parsePollInterval(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, errSeconds := strconv.Atoi(value)
+		if errSeconds != nil {
+			fmt.Printf("Ignoring %s=%q, expected a duration\n", name, value)
+			return fallback
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval < time.Second {
+		fmt.Printf("Ignoring %s=%q, the interval must be at least one second\n", name, value)
+		return fallback
+	}
+	return interval
+}
+
+// run polls on every tick and whenever requestPoll asks. Polls only happen
+// here, so two of them never race to install their snapshots.
+func (p *feedPoller) run() {
+	p.poll()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.refresh:
+		}
+		p.poll()
+	}
+}
+
+// requestPoll asks the running poller to poll now. Requests made while one
+// is pending are merged into it.
+func (p *feedPoller) requestPoll() {
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// poll downloads the feed once. A failed download keeps the previous
+// snapshot, whose growing age tells clients it is stale, and is noted in
+// the feed's validation report. A feed counts as
+// new when its header timestamp moved, or always when it has none.
+func (p *feedPoller) poll() {
+	feed, err := p.fetch()
+
+	p.mu.Lock()
+	if err != nil {
+		// log a failure once rather than on every poll while it lasts
+		repeated := p.lastErr != nil && p.lastErr.Error() == err.Error()
+		p.lastErr = err
+		p.mu.Unlock()
+		if !repeated {
+			log.Printf("Error polling %s: %v", p.name, err)
+		}
+		recordFetchFailure(p.name, err, clockNow())
+		return
+	}
+	previous := p.snapshot
+	snapshot := &feedSnapshot{feed: feed, fetchedAt: clockNow()}
+	p.snapshot = snapshot
+	p.lastErr = nil
+	p.mu.Unlock()
+
+	// an unchanged feed is validated too, that is how a stuck one turns stale
+	validateFeed(p.name, snapshot)
+	fresh := previous == nil || snapshot.timestamp().IsZero() || !snapshot.timestamp().Equal(previous.timestamp())
+	if fresh {
+		archiveFeed(p.name, snapshot)
+	}
+	if fresh && p.onUpdate != nil {
+		p.onUpdate(snapshot)
+	}
+}
+
+// latest returns the current snapshot. Before the pollers are started it
+// downloads the feed on demand so the handlers keep working without them.
+func (p *feedPoller) latest() (*feedSnapshot, error) {
+	p.mu.RLock()
+	snapshot, lastErr, started := p.snapshot, p.lastErr, p.started
+	p.mu.RUnlock()
+
+	if snapshot != nil {
+		return snapshot, nil
+	}
+	if !started {
+		p.poll()
+		p.mu.RLock()
+		snapshot, lastErr = p.snapshot, p.lastErr
+		p.mu.RUnlock()
+		if snapshot != nil {
+			return snapshot, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("no %s snapshot available: %w", p.name, lastErr)
+	}
+	return nil, fmt.Errorf("no %s snapshot available yet", p.name)
+}
+
+// setSnapshotHeaders reports how fresh the realtime data behind a response
+// is: X-Feed-Age in whole seconds since download and X-Feed-Timestamp as
+// the feed header's unix time.
+func setSnapshotHeaders(c *gin.Context, snapshot *feedSnapshot) {
+	if snapshot == nil {
+		return
+	}
+	c.Header("X-Feed-Age", strconv.FormatInt(int64(snapshot.age().Seconds()), 10))
+	if ts := snapshot.timestamp(); !ts.IsZero() {
+		c.Header("X-Feed-Timestamp", strconv.FormatInt(ts.Unix(), 10))
+	}
+}
@@ -0,0 +1,227 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// The prediction engine turns a trip's schedule and its TripUpdate into a
+// predicted time for every stop, following the GTFS-RT propagation rules:
+//
+//   - a delay applies to its own stop and carries on to later stops until
+//     the next update, stops before the first update keep the schedule
+//   - an absolute time is converted to a delay against that stop's schedule
+//   - a SKIPPED stop is not served, the delay carries on past it
+//   - NO_DATA leaves its stop, and the stops after it until the next
+//     update, without a prediction
+//   - a vehicle cannot reach a stop before leaving the previous one, nor
+//     leave a stop before arriving
+//
+// Departure boards, the planner and /trips/:id/realtime all read from it.
+
+type predictedStop struct {
+	arrival        int // seconds after the service day start
+	departure      int
+	arrivalDelay   int // seconds, positive when late
+	departureDelay int
+	realtime       bool // covered by an update at this stop or before it
+	updated        bool // the update was for this very stop
+	skipped        bool
+}
+
+// tripSchedule reads a trip's stop times as seconds after the service day
+// start, ok is false when any of them cannot be parsed.
+func tripSchedule(stopTimes []processing.StopTime) (sequences, arrivals, departures []int, ok bool) {
+	sequences = make([]int, len(stopTimes))
+	arrivals = make([]int, len(stopTimes))
+	departures = make([]int, len(stopTimes))
+	for i, st := range stopTimes {
+		arr, errArr := processing.ParseGTFSTime(st.ArrivalTime)
+		dep, errDep := processing.ParseGTFSTime(st.DepartureTime)
+		if errArr != nil || errDep != nil {
+			return nil, nil, nil, false
+		}
+		sequences[i], arrivals[i], departures[i] = st.StopSequence, arr, dep
+	}
+	return sequences, arrivals, departures, true
+}
+
+// predictStops applies a TripUpdate to one run of a trip whose service day
+// starts at dayStart. Updates are expected in stop_sequence order, as the
+// specification requires. Cancellation and start_date are the caller's
+// concern.
+func predictStops(tripID string, sequences, arrivals, departures []int, dayStart int64, tu *gtfs.TripUpdate) []predictedStop {
+	predicted := make([]predictedStop, len(sequences))
+	stopTimes, _ := findStopTimesByTripID(tripID)
+
+	arrivalDelay, departureDelay := 0, 0
+	propagating := false
+	next, matched := 0, -1
+	for pos, sequence := range sequences {
+		p := &predicted[pos]
+		for ; tu != nil && next < len(tu.StopTimeUpdate); next++ {
+			stu := tu.StopTimeUpdate[next]
+			updateSequence := stopTimeUpdateSequence(stopTimes, matched, stu)
+			if updateSequence < 0 {
+				// an update that matches no stop of the trip is ignored
+				continue
+			}
+			if updateSequence > sequence {
+				break
+			}
+			matched = updateSequence
+			exact := updateSequence == sequence
+			if exact {
+				p.updated = true
+			}
+
+			switch stu.GetScheduleRelationship() {
+			case gtfs.TripUpdate_StopTimeUpdate_SKIPPED:
+				if exact {
+					p.skipped = true
+				}
+				continue
+			case gtfs.TripUpdate_StopTimeUpdate_NO_DATA:
+				arrivalDelay, departureDelay = 0, 0
+				propagating = false
+				continue
+			}
+
+			arrival, departure := stu.GetArrival(), stu.GetDeparture()
+			if arrival == nil {
+				arrival = departure
+			}
+			if departure == nil {
+				departure = arrival
+			}
+			if delay, ok := eventDelay(arrival, exact, dayStart+int64(arrivals[pos])); ok {
+				arrivalDelay = delay
+				propagating = true
+			}
+			if delay, ok := eventDelay(departure, exact, dayStart+int64(departures[pos])); ok {
+				departureDelay = delay
+				propagating = true
+			}
+		}
+
+		p.realtime = propagating
+		p.arrival, p.departure = arrivals[pos], departures[pos]
+		if !propagating {
+			continue
+		}
+		p.arrival += arrivalDelay
+		p.departure += departureDelay
+		if pos > 0 && predicted[pos-1].realtime && !predicted[pos-1].skipped && p.arrival < predicted[pos-1].departure {
+			p.arrival = predicted[pos-1].departure
+		}
+		if p.departure < p.arrival {
+			p.departure = p.arrival
+		}
+		p.arrivalDelay = p.arrival - arrivals[pos]
+		p.departureDelay = p.departure - departures[pos]
+	}
+	return predicted
+}
+
+// eventDelay reads the delay of a StopTimeEvent. An absolute time is only
+// usable when the update belongs to the stop being predicted, whose
+// scheduled unix time is given.
+func eventDelay(event *gtfs.TripUpdate_StopTimeEvent, exact bool, scheduled int64) (int, bool) {
+	switch {
+	case event == nil:
+		return 0, false
+	case event.Delay != nil:
+		return int(event.GetDelay()), true
+	case exact && event.Time != nil:
+		return int(event.GetTime() - scheduled), true
+	default:
+		return 0, false
+	}
+}
+
+// pickTripUpdate chooses among the updates for one trip, which may cover
+// runs on several days: the one whose start_date is the service date, else
+// one without a start_date. Without a service date the first one wins.
+func pickTripUpdate(updates []*gtfs.TripUpdate, serviceDate string) *gtfs.TripUpdate {
+	if serviceDate == "" {
+		if len(updates) > 0 {
+			return updates[0]
+		}
+		return nil
+	}
+	var undated *gtfs.TripUpdate
+	for _, tu := range updates {
+		switch tu.GetTrip().GetStartDate() {
+		case serviceDate:
+			return tu
+		case "":
+			if undated == nil {
+				undated = tu
+			}
+		}
+	}
+	return undated
+}
+
+// predictTripRun builds the full predicted stop list of a trip on a
+// service date. A nil TripUpdate, or one for another start_date, gives
+// the plain schedule.
+func predictTripRun(trip processing.Trip, date time.Time, tu *gtfs.TripUpdate) processing.TripPrediction {
+	serviceDate := date.Format(serviceDateLayout)
+	dayStart := serviceDayStart(date).Unix()
+	if tu != nil {
+		if startDate := tu.GetTrip().GetStartDate(); startDate != "" && startDate != serviceDate {
+			tu = nil
+		}
+	}
+
+	prediction := processing.TripPrediction{
+		TripID:      trip.TripID,
+		RouteID:     trip.RouteID,
+		ServiceDate: serviceDate,
+		StopTimes:   []processing.PredictedStopTime{},
+	}
+	if tu != nil {
+		prediction.Realtime = true
+		prediction.Canceled = tu.GetTrip().GetScheduleRelationship() == gtfs.TripDescriptor_CANCELED
+		prediction.VehicleID = tu.GetVehicle().GetId()
+		prediction.Timestamp = int64(tu.GetTimestamp())
+		if prediction.Canceled {
+			tu = nil
+		}
+	}
+
+	stopTimes, _ := findStopTimesByTripID(trip.TripID)
+	sequences, arrivals, departures, ok := tripSchedule(stopTimes)
+	if !ok {
+		return prediction
+	}
+	predicted := predictStops(trip.TripID, sequences, arrivals, departures, dayStart, tu)
+
+	for i, st := range stopTimes {
+		p := predicted[i]
+		stop, _ := findStopById(st.StopID)
+		stopTime := processing.PredictedStopTime{
+			StopID:                 st.StopID,
+			StopName:               stop.StopName,
+			StopSequence:           st.StopSequence,
+			ScheduledArrival:       st.ArrivalTime,
+			ScheduledDeparture:     st.DepartureTime,
+			ScheduledArrivalTime:   dayStart + int64(arrivals[i]),
+			ScheduledDepartureTime: dayStart + int64(departures[i]),
+			Realtime:               p.realtime,
+			Updated:                p.updated,
+			Skipped:                p.skipped || prediction.Canceled,
+		}
+		if p.realtime && !stopTime.Skipped {
+			stopTime.PredictedArrivalTime = dayStart + int64(p.arrival)
+			stopTime.PredictedDepartureTime = dayStart + int64(p.departure)
+			stopTime.ArrivalDelay = int64(p.arrivalDelay)
+			stopTime.DepartureDelay = int64(p.departureDelay)
+		}
+		prediction.StopTimes = append(prediction.StopTimes, stopTime)
+	}
+	return prediction
+}
@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// stopWant is the expected prediction of one stop, delays in seconds.
+type stopWant struct {
+	realtime       bool
+	skipped        bool
+	arrivalDelay   int
+	departureDelay int
+}
+
+func TestPredictStops(t *testing.T) {
+	loadTestTrip(t, "t1", 4)
+	stopTimes, _ := findStopTimesByTripID("t1")
+	sequences, arrivals, departures, ok := tripSchedule(stopTimes)
+	if !ok {
+		t.Fatal("test schedule did not parse")
+	}
+	dayStart := testServiceDate.Unix()
+
+	noData := func(sequence uint32) *gtfs.TripUpdate_StopTimeUpdate {
+		return &gtfs.TripUpdate_StopTimeUpdate{
+			StopSequence:         proto.Uint32(sequence),
+			ScheduleRelationship: gtfs.TripUpdate_StopTimeUpdate_NO_DATA.Enum(),
+		}
+	}
+	scheduled := func(minutes int) int64 { return dayStart + 8*3600 + int64(minutes)*60 }
+
+	tests := []struct {
+		name    string
+		updates []*gtfs.TripUpdate_StopTimeUpdate
+		want    [4]stopWant
+	}{
+		{
+			name: "no updates keeps the schedule",
+		},
+		{
+			name:    "delay carries forward, earlier stops keep the schedule",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(2, 120)},
+			want:    [4]stopWant{{}, {true, false, 120, 120}, {true, false, 120, 120}, {true, false, 120, 120}},
+		},
+		{
+			name: "absolute time becomes a delay",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{{
+				StopSequence: proto.Uint32(3),
+				Arrival:      &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(scheduled(25))},
+				Departure:    &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(scheduled(26))},
+			}},
+			want: [4]stopWant{{}, {}, {true, false, 300, 300}, {true, false, 300, 300}},
+		},
+		{
+			name:    "delay carries past a skipped stop",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(1, 120), skippedUpdate(2)},
+			want:    [4]stopWant{{true, false, 120, 120}, {true, true, 120, 120}, {true, false, 120, 120}, {true, false, 120, 120}},
+		},
+		{
+			name:    "no data stops propagation until the next update",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(1, 120), noData(2), delayUpdate(4, 60)},
+			want:    [4]stopWant{{true, false, 120, 120}, {}, {}, {true, false, 60, 60}},
+		},
+		{
+			name: "arrival is clamped to the previous departure",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{delayUpdate(1, 600), {
+				StopSequence: proto.Uint32(2),
+				Arrival:      &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(0)},
+				Departure:    &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(0)},
+			}},
+			// stop 1 departs 08:11, stop 2 is due 08:10 and leaves 08:11
+			want: [4]stopWant{{true, false, 600, 600}, {true, false, 60, 0}, {true, false, 0, 0}, {true, false, 0, 0}},
+		},
+		{
+			name: "departure is clamped to the arrival",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{{
+				StopSequence: proto.Uint32(2),
+				Arrival:      &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(180)},
+				Departure:    &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(0)},
+			}},
+			want: [4]stopWant{{}, {true, false, 180, 120}, {true, false, 180, 120}, {true, false, 180, 120}},
+		},
+		{
+			name: "an unresolvable update does not hide later ones",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{{
+				StopId:    proto.String("nowhere"),
+				Departure: &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(999)},
+			}, delayUpdate(3, 60)},
+			want: [4]stopWant{{}, {}, {true, false, 60, 60}, {true, false, 60, 60}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tu := &gtfs.TripUpdate{
+				Trip:           &gtfs.TripDescriptor{TripId: proto.String("t1")},
+				StopTimeUpdate: test.updates,
+			}
+			predicted := predictStops("t1", sequences, arrivals, departures, dayStart, tu)
+
+			for i, p := range predicted {
+				got := stopWant{p.realtime, p.skipped, p.arrivalDelay, p.departureDelay}
+				if got != test.want[i] {
+					t.Errorf("stop %d: got %+v, want %+v", sequences[i], got, test.want[i])
+				}
+				if p.departure < p.arrival {
+					t.Errorf("stop %d: departs at %d before arriving at %d", sequences[i], p.departure, p.arrival)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictStopsLoopTrip(t *testing.T) {
+	loadTestTrip(t, "loop", 4)
+	// the loop returns to where it started, and the stop_id lookup map
+	// holds the last visit as it does after loading
+	stopTimes := TripStopTimesMap["loop"]
+	stopTimes[3].StopID = "s1"
+	StopTimesMap["loop_s1"] = stopTimes[3]
+	sequences, arrivals, departures, _ := tripSchedule(stopTimes)
+	dayStart := testServiceDate.Unix()
+
+	atStop := func(stopID string, delay int32) *gtfs.TripUpdate_StopTimeUpdate {
+		return &gtfs.TripUpdate_StopTimeUpdate{
+			StopId:    proto.String(stopID),
+			Departure: &gtfs.TripUpdate_StopTimeEvent{Delay: proto.Int32(delay)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		updates []*gtfs.TripUpdate_StopTimeUpdate
+		want    [4]stopWant
+	}{
+		{
+			name:    "first visit",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{atStop("s1", 120)},
+			want:    [4]stopWant{{true, false, 120, 120}, {true, false, 120, 120}, {true, false, 120, 120}, {true, false, 120, 120}},
+		},
+		{
+			name:    "second visit after a matched stop",
+			updates: []*gtfs.TripUpdate_StopTimeUpdate{atStop("s2", 60), atStop("s1", 300)},
+			want:    [4]stopWant{{}, {true, false, 60, 60}, {true, false, 60, 60}, {true, false, 300, 300}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tu := &gtfs.TripUpdate{
+				Trip:           &gtfs.TripDescriptor{TripId: proto.String("loop")},
+				StopTimeUpdate: test.updates,
+			}
+			predicted := predictStops("loop", sequences, arrivals, departures, dayStart, tu)
+
+			for i, p := range predicted {
+				got := stopWant{p.realtime, p.skipped, p.arrivalDelay, p.departureDelay}
+				if got != test.want[i] {
+					t.Errorf("stop %d: got %+v, want %+v", sequences[i], got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPickTripUpdate(t *testing.T) {
+	run := func(startDate string) *gtfs.TripUpdate {
+		trip := &gtfs.TripDescriptor{TripId: proto.String("t1")}
+		if startDate != "" {
+			trip.StartDate = proto.String(startDate)
+		}
+		return &gtfs.TripUpdate{Trip: trip}
+	}
+	yesterday, undated, today := run("20251024"), run(""), run("20251025")
+	updates := []*gtfs.TripUpdate{yesterday, undated, today}
+
+	if got := pickTripUpdate(updates, "20251025"); got != today {
+		t.Errorf("got start_date %q, want the matching run", got.GetTrip().GetStartDate())
+	}
+	if got := pickTripUpdate(updates, "20251026"); got != undated {
+		t.Errorf("got start_date %q, want the undated run", got.GetTrip().GetStartDate())
+	}
+	if got := pickTripUpdate([]*gtfs.TripUpdate{yesterday}, "20251025"); got != nil {
+		t.Errorf("got start_date %q, want none", got.GetTrip().GetStartDate())
+	}
+	if got := pickTripUpdate(updates, ""); got != yesterday {
+		t.Errorf("without a date got start_date %q, want the first", got.GetTrip().GetStartDate())
+	}
+}
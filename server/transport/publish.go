@@ -0,0 +1,256 @@
+package transport
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// The cached feeds are re-published as standard GTFS-RT protobuf for
+// consumers that do not want our JSON, together with a combined feed that
+// merges all three with entities authored here, such as a detour alert
+// that the agency has not published yet.
+
+const protobufContentType = "application/x-protobuf"
+
+var localEntitiesMu sync.RWMutex
+var localEntities = make(map[string]*gtfs.FeedEntity)
+
+func renderFeed(c *gin.Context, feed *gtfs.FeedMessage) {
+	data, err := proto.Marshal(feed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error encoding feed: %v", err)})
+		return
+	}
+	c.Data(http.StatusOK, protobufContentType, data)
+}
+
+func renderRawFeed(c *gin.Context, poller *feedPoller) {
+	snapshot, err := poller.latest()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching %s: %v", poller.name, err)})
+		return
+	}
+	setSnapshotHeaders(c, snapshot)
+	renderFeed(c, snapshot.feed)
+}
+
+// GET /alerts.pb
+func HandleAlertsProtobuf(c *gin.Context) {
+	renderRawFeed(c, alertsPoller)
+}
+
+// renderFilteredFeed is renderRawFeed with the realtime filters applied,
+// the header is kept so the result is still a valid full dataset.
+func renderFilteredFeed(c *gin.Context, poller *feedPoller) {
+	filter, err := parseRealtimeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(c.Request.URL.RawQuery) == 0 {
+		renderRawFeed(c, poller)
+		return
+	}
+	snapshot, err := poller.latest()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Error fetching %s: %v", poller.name, err)})
+		return
+	}
+	setSnapshotHeaders(c, snapshot)
+	renderFeed(c, &gtfs.FeedMessage{Header: snapshot.feed.Header, Entity: snapshot.entities(filter)})
+}
+
+// GET /tripupdates.pb
+func HandleTripUpdatesProtobuf(c *gin.Context) {
+	renderFilteredFeed(c, tripUpdatesPoller)
+}
+
+// GET /vehiclepositions.pb
+func HandleVehiclePositionsProtobuf(c *gin.Context) {
+	renderFilteredFeed(c, vehiclePositionsPoller)
+}
+
+// GET /feed.pb
+// The combined feed is built from whatever snapshots are available, so one
+// failing upstream does not take the others down. Its timestamp is the
+// newest of the parts.
+func HandleCombinedFeed(c *gin.Context) {
+	combined := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfs.FeedHeader_FULL_DATASET.Enum(),
+		},
+	}
+
+	var newest uint64
+	seen := make(map[string]bool)
+	add := func(prefix string, entity *gtfs.FeedEntity) {
+		// entity ids must be unique within a feed, only rename on a clash
+		if seen[entity.GetId()] {
+			entity = proto.Clone(entity).(*gtfs.FeedEntity)
+			entity.Id = proto.String(prefix + ":" + entity.GetId())
+		}
+		seen[entity.GetId()] = true
+		combined.Entity = append(combined.Entity, entity)
+	}
+
+	var missing []string
+	for _, poller := range feedPollers {
+		snapshot, err := poller.latest()
+		if err != nil {
+			missing = append(missing, poller.name)
+			continue
+		}
+		if ts := snapshot.feed.GetHeader().GetTimestamp(); ts > newest {
+			newest = ts
+		}
+		for _, entity := range snapshot.feed.Entity {
+			add(strings.ToLower(poller.name), entity)
+		}
+	}
+
+	for _, entity := range sortedLocalEntities() {
+		add("local", entity)
+	}
+
+	if newest == 0 {
+		newest = uint64(clockNow().Unix())
+	}
+	combined.Header.Timestamp = proto.Uint64(newest)
+	if len(missing) > 0 {
+		c.Header("X-Feed-Missing", strings.Join(missing, ","))
+	}
+	renderFeed(c, combined)
+}
+
+func sortedLocalEntities() []*gtfs.FeedEntity {
+	localEntitiesMu.RLock()
+	defer localEntitiesMu.RUnlock()
+
+	entities := make([]*gtfs.FeedEntity, 0, len(localEntities))
+	for _, entity := range localEntities {
+		entities = append(entities, entity)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].GetId() < entities[j].GetId()
+	})
+	return entities
+}
+
+// authorizeLocalEntities guards the authoring endpoints with the bearer
+// token in LOCAL_ENTITIES_TOKEN. Without one authoring is disabled.
+func authorizeLocalEntities(c *gin.Context) bool {
+	return authorizeBearer(c, "LOCAL_ENTITIES_TOKEN", "authoring local entities")
+}
+
+// authorizeBearer checks the request's bearer token against the one in
+// envVar. Without a token configured the action is disabled.
+func authorizeBearer(c *gin.Context, envVar, action string) bool {
+	token := os.Getenv(envVar)
+	if token == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s is disabled, set %s to enable it", action, envVar)})
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing bearer token"})
+		return false
+	}
+	return true
+}
+
+// GET /entities
+func HandleLocalEntities(c *gin.Context) {
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(uint64(clockNow().Unix())),
+		},
+		Entity: sortedLocalEntities(),
+	}
+	if c.Query("format") == "protobuf" {
+		renderFeed(c, feed)
+		return
+	}
+	data, err := protojson.Marshal(feed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error encoding entities: %v", err)})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// POST /entities
+// The body is one GTFS-RT FeedEntity, as protobuf when the Content-Type is
+// application/x-protobuf and as protobuf JSON otherwise. An entity with an
+// existing id replaces it.
+func HandleAddLocalEntity(c *gin.Context) {
+	if !authorizeLocalEntities(c) {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Error reading body: %v", err)})
+		return
+	}
+
+	entity := &gtfs.FeedEntity{}
+	if strings.HasPrefix(c.ContentType(), protobufContentType) {
+		err = proto.Unmarshal(body, entity)
+	} else {
+		err = protojson.Unmarshal(body, entity)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid FeedEntity: %v", err)})
+		return
+	}
+	if entity.GetId() == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "FeedEntity id is required"})
+		return
+	}
+	if entity.Alert == nil && entity.TripUpdate == nil && entity.Vehicle == nil && !entity.GetIsDeleted() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "FeedEntity needs an alert, trip_update or vehicle"})
+		return
+	}
+
+	localEntitiesMu.Lock()
+	_, replaced := localEntities[entity.GetId()]
+	localEntities[entity.GetId()] = entity
+	localEntitiesMu.Unlock()
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"id": entity.GetId(), "replaced": replaced})
+}
+
+// DELETE /entities/:id
+func HandleDeleteLocalEntity(c *gin.Context) {
+	if !authorizeLocalEntities(c) {
+		return
+	}
+
+	id := c.Param("id")
+	localEntitiesMu.Lock()
+	_, found := localEntities[id]
+	delete(localEntities, id)
+	localEntitiesMu.Unlock()
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Entity with ID %s not found", id)})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"sort"
+)
+
+var RouteStopsMap = make(map[string][]processing.RouteDirectionStops) // route_id -> ordered stops per direction
+var StopRoutesMap = make(map[string][]processing.StopRoute)           // stop_id -> routes serving it
+
+// InitRelationships precomputes the route to stops and stop to routes
+// indexes from the derived stop patterns, so it must run after InitPatterns.
+func InitRelationships() {
+	type routeDirection struct {
+		routeID     string
+		directionID int
+	}
+
+	// a pattern lists its headsigns but not how many of its trips carry
+	// each, so they are counted from the trips
+	patternHeadsigns := make(map[string]map[string]int) // pattern_id -> headsign -> trips
+	for tripID, patternID := range TripPatternMap {
+		trip, found := findTripByID(tripID)
+		if !found {
+			continue
+		}
+		if patternHeadsigns[patternID] == nil {
+			patternHeadsigns[patternID] = make(map[string]int)
+		}
+		patternHeadsigns[patternID][trip.TripHeadsign]++
+	}
+
+	stopHeadsigns := make(map[string]map[routeDirection]map[string]int)
+
+	for routeID, patterns := range RoutePatternsMap {
+		for _, directionID := range []int{0, 1} {
+			var sequences [][]string
+			headsigns := make(map[string]int)
+			stopsByID := make(map[string]processing.PatternStop)
+
+			for _, pattern := range patterns {
+				if pattern.DirectionID != directionID {
+					continue
+				}
+				var sequence []string
+				for _, stop := range pattern.Stops {
+					sequence = append(sequence, stop.StopID)
+					stopsByID[stop.StopID] = stop
+
+					key := routeDirection{routeID: routeID, directionID: directionID}
+					if stopHeadsigns[stop.StopID] == nil {
+						stopHeadsigns[stop.StopID] = make(map[routeDirection]map[string]int)
+					}
+					if stopHeadsigns[stop.StopID][key] == nil {
+						stopHeadsigns[stop.StopID][key] = make(map[string]int)
+					}
+					for headsign, trips := range patternHeadsigns[pattern.PatternID] {
+						stopHeadsigns[stop.StopID][key][headsign] += trips
+					}
+				}
+				sequences = append(sequences, sequence)
+				for headsign, trips := range patternHeadsigns[pattern.PatternID] {
+					headsigns[headsign] += trips
+				}
+			}
+			if len(sequences) == 0 {
+				continue
+			}
+
+			direction := processing.RouteDirectionStops{
+				RouteID:     routeID,
+				DirectionID: directionID,
+				Headsigns:   rankedKeys(headsigns),
+			}
+			for _, stopID := range mergeStopSequences(sequences) {
+				direction.Stops = append(direction.Stops, stopsByID[stopID])
+			}
+			RouteStopsMap[routeID] = append(RouteStopsMap[routeID], direction)
+		}
+	}
+
+	for stopID, byRoute := range stopHeadsigns {
+		var stopRoutes []processing.StopRoute
+		for key, headsigns := range byRoute {
+			stopRoute := processing.StopRoute{
+				RouteID:     key.routeID,
+				DirectionID: key.directionID,
+				Headsigns:   rankedKeys(headsigns),
+			}
+			if route, ok := findRouteByID(key.routeID); ok {
+				stopRoute.RouteShortName = route.RouteShortName
+				stopRoute.RouteLongName = route.RouteLongName
+				stopRoute.RouteColor = route.RouteColor
+				stopRoute.RouteTextColor = route.RouteTextColor
+			}
+			stopRoutes = append(stopRoutes, stopRoute)
+		}
+		sort.Slice(stopRoutes, func(i, j int) bool {
+			if stopRoutes[i].RouteID != stopRoutes[j].RouteID {
+				return stopRoutes[i].RouteID < stopRoutes[j].RouteID
+			}
+			return stopRoutes[i].DirectionID < stopRoutes[j].DirectionID
+		})
+		StopRoutesMap[stopID] = stopRoutes
+	}
+
+	fmt.Printf("RouteStopsMap initialized with %d routes, StopRoutesMap with %d stops\n", len(RouteStopsMap), len(StopRoutesMap))
+}
+
+func findStopsByRouteID(routeId string) ([]processing.RouteDirectionStops, bool) {
+	directions, found := RouteStopsMap[routeId]
+	return directions, found
+}
+
+func findRoutesByStopID(stopId string) ([]processing.StopRoute, bool) {
+	routes, found := StopRoutesMap[stopId]
+	return routes, found
+}
@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"testing"
+)
+
+func TestInitRelationshipsCountsHeadsignsPerTrip(t *testing.T) {
+	// three of the four trips on the long pattern are headed to X, the one
+	// trip on the short pattern to Y
+	headsigns := map[string]string{"long1": "X", "long2": "X", "long3": "X", "long4": "Y", "short": "Y"}
+	for tripID, headsign := range headsigns {
+		stops := 3
+		if tripID == "short" {
+			stops = 2
+		}
+		loadTestTrip(t, tripID, stops)
+		TripsMap[tripID] = processing.Trip{TripID: tripID, RouteID: "r1", TripHeadsign: headsign}
+	}
+	t.Cleanup(func() {
+		RoutePatternsMap = make(map[string][]processing.StopPattern)
+		TripPatternMap = make(map[string]string)
+		RouteStopsMap = make(map[string][]processing.RouteDirectionStops)
+		StopRoutesMap = make(map[string][]processing.StopRoute)
+	})
+
+	InitPatterns()
+	InitRelationships()
+
+	directions := RouteStopsMap["r1"]
+	if len(directions) != 1 {
+		t.Fatalf("got %d directions, want 1", len(directions))
+	}
+	if got := directions[0].Headsigns; len(got) != 2 || got[0] != "X" {
+		t.Errorf("route headsigns %v, want X first", got)
+	}
+	for _, stopRoute := range StopRoutesMap["s1"] {
+		if got := stopRoute.Headsigns; len(got) != 2 || got[0] != "X" {
+			t.Errorf("headsigns at s1 %v, want X first", got)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+)
+
+// With GTFSRT_RECORD_DIR set every new feed is archived as
+//
+//	<dir>/<feed>/<unix milliseconds>.pb
+//
+// where <feed> is alerts, tripupdates or vehiclepositions. With
+// GTFSRT_RECORD_RETENTION set, recordings older than that are removed as
+// new ones come in. Pointing
+// GTFSRT_REPLAY_DIR at such an archive instead plays it back: the pollers
+// read the recording that was current at the virtual clock's time, and the
+// rest of the server reads the clock too, so it behaves as if it were that
+// moment. The clock is controlled through /gtfs/replay.
+
+const (
+	replayPollInterval  = time.Second
+	maxReplaySpeed      = 1000
+	recordPruneInterval = 10 * time.Minute
+)
+
+var (
+	recordDir       string
+	recordRetention time.Duration // zero keeps every recording
+
+	recordPruneMu sync.Mutex
+	recordPruned  = make(map[string]time.Time) // feed -> last pruned
+)
+
+// feedArchive is one feed's recordings ordered by time.
+type feedArchive struct {
+	times []time.Time
+	files []string
+}
+
+// LoadReplay configures recording and replay from GTFSRT_RECORD_DIR,
+// GTFSRT_RECORD_RETENTION (a duration such as "168h"), GTFSRT_REPLAY_DIR, GTFSRT_REPLAY_START (RFC3339 or unix seconds, the
+// first recording by default) and GTFSRT_REPLAY_SPEED (1 by default).
+func LoadReplay() error {
+	recordDir = os.Getenv("GTFSRT_RECORD_DIR")
+	replayDir := os.Getenv("GTFSRT_REPLAY_DIR")
+	if recordDir != "" && replayDir != "" {
+		return fmt.Errorf("GTFSRT_RECORD_DIR and GTFSRT_REPLAY_DIR cannot both be set")
+	}
+
+	if recordDir != "" {
+		if value := os.Getenv("GTFSRT_RECORD_RETENTION"); value != "" {
+			retention, err := time.ParseDuration(value)
+			if err != nil || retention <= 0 {
+				return fmt.Errorf("GTFSRT_RECORD_RETENTION must be a positive duration, got %q", value)
+			}
+			recordRetention = retention
+		}
+		for _, source := range []*feedSource{alertsSource, tripUpdatesSource, vehiclePositionsSource} {
+			if err := os.MkdirAll(filepath.Join(recordDir, archiveName(source.name)), 0o755); err != nil {
+				return fmt.Errorf("GTFSRT_RECORD_DIR: %w", err)
+			}
+			pruneRecordings(source.name, time.Now())
+		}
+		fmt.Printf("Recording realtime feeds to %s\n", recordDir)
+		return nil
+	}
+	if replayDir == "" {
+		return nil
+	}
+
+	var first time.Time
+	for _, source := range []*feedSource{alertsSource, tripUpdatesSource, vehiclePositionsSource} {
+		archive, err := loadFeedArchive(filepath.Join(replayDir, archiveName(source.name)))
+		if err != nil {
+			return fmt.Errorf("GTFSRT_REPLAY_DIR: %w", err)
+		}
+		source.archive = archive
+		if len(archive.times) > 0 && (first.IsZero() || archive.times[0].Before(first)) {
+			first = archive.times[0]
+		}
+		fmt.Printf("%s source: replaying %d recordings\n", source.name, len(archive.times))
+	}
+	if first.IsZero() {
+		return fmt.Errorf("GTFSRT_REPLAY_DIR: no recordings in %s", replayDir)
+	}
+
+	start := first
+	if value := os.Getenv("GTFSRT_REPLAY_START"); value != "" {
+		var err error
+		if start, err = parseRequestTime(value); err != nil {
+			return fmt.Errorf("GTFSRT_REPLAY_START must be unix seconds or RFC3339, got %q", value)
+		}
+	}
+	speed := 1.0
+	if value := os.Getenv("GTFSRT_REPLAY_SPEED"); value != "" {
+		var err error
+		if speed, err = parseReplaySpeed(value); err != nil {
+			return fmt.Errorf("GTFSRT_REPLAY_SPEED: %w", err)
+		}
+	}
+
+	clock.start(start, speed)
+	fmt.Printf("Replaying realtime feeds from %s at %gx\n", start.Format(time.RFC3339), speed)
+	return nil
+}
+
+func replaying() bool {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.virtual
+}
+
+func archiveName(feedName string) string {
+	return strings.ToLower(feedName)
+}
+
+func parseReplaySpeed(value string) (float64, error) {
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed <= 0 || speed > maxReplaySpeed {
+		return 0, fmt.Errorf("speed must be a number above 0 and at most %d", maxReplaySpeed)
+	}
+	return speed, nil
+}
+
+func loadFeedArchive(dir string) (*feedArchive, error) {
+	archive := &feedArchive{}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pb"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		millis, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(file), ".pb"), 10, 64)
+		if err != nil {
+			continue
+		}
+		archive.times = append(archive.times, time.UnixMilli(millis))
+		archive.files = append(archive.files, file)
+	}
+	return archive, nil
+}
+
+// read returns the recording that was current at the given time.
+func (a *feedArchive) read(at time.Time) ([]byte, error) {
+	if len(a.times) == 0 {
+		return nil, fmt.Errorf("nothing recorded for this feed")
+	}
+	i := sort.Search(len(a.times), func(i int) bool { return a.times[i].After(at) }) - 1
+	if i < 0 {
+		return nil, fmt.Errorf("the replay clock is before the first recording at %s", a.times[0].Format(time.RFC3339))
+	}
+	return os.ReadFile(a.files[i])
+}
+
+// archiveFeed stores a new feed when recording and now and then removes
+// the expired recordings. Failures are logged and do not affect serving.
+func archiveFeed(feedName string, snapshot *feedSnapshot) {
+	if recordDir == "" {
+		return
+	}
+	data, err := proto.Marshal(snapshot.feed)
+	if err == nil {
+		name := fmt.Sprintf("%013d.pb", snapshot.fetchedAt.UnixMilli())
+		err = os.WriteFile(filepath.Join(recordDir, archiveName(feedName), name), data, 0o644)
+	}
+	if err != nil {
+		log.Printf("Error recording %s: %v", feedName, err)
+	}
+	pruneRecordings(feedName, snapshot.fetchedAt)
+}
+
+// pruneRecordings removes a feed's recordings that are older than the
+// retention, at most once every recordPruneInterval.
+func pruneRecordings(feedName string, now time.Time) {
+	if recordRetention == 0 {
+		return
+	}
+	recordPruneMu.Lock()
+	if now.Sub(recordPruned[feedName]) < recordPruneInterval {
+		recordPruneMu.Unlock()
+		return
+	}
+	recordPruned[feedName] = now
+	recordPruneMu.Unlock()
+
+	archive, err := loadFeedArchive(filepath.Join(recordDir, archiveName(feedName)))
+	if err != nil {
+		log.Printf("Error pruning %s recordings: %v", feedName, err)
+		return
+	}
+	cutoff := now.Add(-recordRetention)
+	for i, recorded := range archive.times {
+		if !recorded.Before(cutoff) {
+			break
+		}
+		if err := os.Remove(archive.files[i]); err != nil {
+			log.Printf("Error removing expired recording %s: %v", archive.files[i], err)
+		}
+	}
+}
+
+func replayStatus() processing.ReplayStatus {
+	now, speed, paused := clock.state()
+	status := processing.ReplayStatus{
+		Replaying: replaying(),
+		Recording: recordDir != "",
+		Now:       now.Unix(),
+		Speed:     speed,
+		Paused:    paused,
+	}
+	for _, source := range []*feedSource{alertsSource, tripUpdatesSource, vehiclePositionsSource} {
+		if source.archive == nil || len(source.archive.times) == 0 {
+			continue
+		}
+		first, last := source.archive.times[0].Unix(), source.archive.times[len(source.archive.times)-1].Unix()
+		if status.Start == 0 || first < status.Start {
+			status.Start = first
+		}
+		if last > status.End {
+			status.End = last
+		}
+	}
+	return status
+}
+
+// GET /replay
+func HandleReplayStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, replayStatus())
+}
+
+// POST /replay?pause=true|false&speed=&seek=
+// Any combination of the parameters may be given. After a seek the feeds
+// are read again at once and recorded positions past the new time are
+// forgotten. Requires the bearer token in GTFSRT_REPLAY_TOKEN.
+func HandleReplayControl(c *gin.Context) {
+	if !authorizeBearer(c, "GTFSRT_REPLAY_TOKEN", "controlling the replay") {
+		return
+	}
+	if !replaying() {
+		c.JSON(http.StatusConflict, gin.H{"error": "replay mode is off, set GTFSRT_REPLAY_DIR to enable it"})
+		return
+	}
+
+	var pause *bool
+	if value := c.Query("pause"); value != "" {
+		paused, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pause must be true or false"})
+			return
+		}
+		pause = &paused
+	}
+	var speed float64
+	if value := c.Query("speed"); value != "" {
+		var err error
+		if speed, err = parseReplaySpeed(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var seek time.Time
+	if value := c.Query("seek"); value != "" {
+		var err error
+		if seek, err = parseRequestTime(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seek must be unix seconds or RFC3339"})
+			return
+		}
+	}
+
+	if pause != nil {
+		clock.setPaused(*pause)
+	}
+	if speed != 0 {
+		clock.setSpeed(speed)
+	}
+	if !seek.IsZero() {
+		clock.seek(seek)
+		forgetVehicleHistoryAfter(seek.Unix())
+		for _, p := range feedPollers {
+			p.requestPoll()
+		}
+	}
+
+	c.JSON(http.StatusOK, replayStatus())
+}
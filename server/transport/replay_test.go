@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestArchiveFeedPrunesExpiredRecordings(t *testing.T) {
+	dir, retention := recordDir, recordRetention
+	recordDir, recordRetention = t.TempDir(), time.Hour
+	t.Cleanup(func() {
+		recordDir, recordRetention = dir, retention
+		recordPruneMu.Lock()
+		delete(recordPruned, "Alerts")
+		recordPruneMu.Unlock()
+	})
+
+	feedDir := filepath.Join(recordDir, archiveName("Alerts"))
+	if err := os.MkdirAll(feedDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	expired := filepath.Join(feedDir, fmt.Sprintf("%013d.pb", now.Add(-2*time.Hour).UnixMilli()))
+	if err := os.WriteFile(expired, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := &gtfs.FeedMessage{Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")}}
+	archiveFeed("Alerts", &feedSnapshot{feed: feed, fetchedAt: now})
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired recording was kept")
+	}
+	archive, err := loadFeedArchive(feedDir)
+	if err != nil || len(archive.files) != 1 {
+		t.Errorf("got recordings %v (%v), want only the new one", archive, err)
+	}
+}
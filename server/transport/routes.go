@@ -10,15 +10,42 @@ func AddGTFSRoutes(r *gin.Engine) {
 		gtfsGroup.GET("/alerts", HandleAlert)
 		gtfsGroup.GET("/tripupdates", HandleTripUpdate)
 		gtfsGroup.GET("/vehiclepositions", HandleVehiclePosition)
+		gtfsGroup.GET("/alerts.pb", HandleAlertsProtobuf)
+		gtfsGroup.GET("/tripupdates.pb", HandleTripUpdatesProtobuf)
+		gtfsGroup.GET("/vehiclepositions.pb", HandleVehiclePositionsProtobuf)
+		gtfsGroup.GET("/feed.pb", HandleCombinedFeed)
+		gtfsGroup.GET("/entities", HandleLocalEntities)
+		gtfsGroup.POST("/entities", HandleAddLocalEntity)
+		gtfsGroup.DELETE("/entities/:id", HandleDeleteLocalEntity)
+		gtfsGroup.GET("/replay", HandleReplayStatus)
+		gtfsGroup.POST("/replay", HandleReplayControl)
+		gtfsGroup.GET("/validation", HandleValidation)
 		gtfsGroup.GET("/routes", HandleRoutes)
 		gtfsGroup.GET("/routes/:id", HandleRoutesById)
+		gtfsGroup.GET("/routes/:id/timetable", HandleRouteTimetable)
+		gtfsGroup.GET("/routes/:id/patterns", HandleRoutePatterns)
+		gtfsGroup.GET("/routes/:id/stops", HandleRouteStops)
 		gtfsGroup.GET("/stops", HandleStops)
+		gtfsGroup.GET("/stops/nearby", HandleStopsNearby)
+		gtfsGroup.GET("/stops/bbox", HandleStopsInBoundingBox)
 		gtfsGroup.GET("/stops/:id", HandleStopsById)
+		gtfsGroup.GET("/stops/:id/routes", HandleStopRoutes)
+		gtfsGroup.GET("/stops/:id/departures", HandleStopDepartures)
+		gtfsGroup.GET("/stops/:id/transfers", HandleStopTransfers)
 		gtfsGroup.GET("/trips", HandleTrips)
 		gtfsGroup.GET("/trips/:id", HandleTripsById)
+		gtfsGroup.GET("/trips/:id/realtime", HandleTripRealtime)
+		gtfsGroup.GET("/trips/:id/track", HandleTripTrack)
+		gtfsGroup.GET("/vehicles/:id/track", HandleVehicleTrack)
 		// gtfsGroup.GET("/shapes", HandleShapes) not implemented due to the size of the response
 		gtfsGroup.GET("/shapes/:id", HandleShapesById)
 		gtfsGroup.GET("/stoptimes/trip/:trip_id", HandleStopTimesByTripId)
 		gtfsGroup.GET("/stoptimes/trip/:trip_id/stop/:stop_id", HandleStopTimesByIds)
+		gtfsGroup.GET("/blocks/:id", HandleBlockById)
+		gtfsGroup.GET("/analytics/headways", HandleHeadways)
+		gtfsGroup.GET("/tiles/:z/:x/:y", HandleVectorTile)
+		gtfsGroup.GET("/search", HandleSearch)
+		gtfsGroup.GET("/plan", HandlePlan)
+		gtfsGroup.GET("/isochrone", HandleIsochrone)
 	}
 }
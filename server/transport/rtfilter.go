@@ -0,0 +1,269 @@
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotIndex maps each filterable key to the positions of the entities
+// that carry it, so a request for one route touches only that route's
+// entities. It is built once per snapshot, on first use.
+type snapshotIndex struct {
+	byRoute     map[string][]int
+	byTrip      map[string][]int
+	byVehicle   map[string][]int
+	byStop      map[string][]int
+	byDirection map[int][]int
+}
+
+type realtimeFilter struct {
+	routeIDs    []string
+	tripIDs     []string
+	vehicleIDs  []string
+	stopIDs     []string
+	directionID *int
+	bbox        *[4]float64 // min_lat, min_lon, max_lat, max_lon
+	maxAge      time.Duration
+}
+
+// parseRealtimeFilter reads route_id, trip_id, vehicle_id and stop_id (each
+// a comma separated list), direction_id, bbox and max_age in seconds.
+func parseRealtimeFilter(c *gin.Context) (realtimeFilter, error) {
+	list := func(name string) []string {
+		var values []string
+		for _, value := range strings.Split(c.Query(name), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	filter := realtimeFilter{
+		routeIDs:   list("route_id"),
+		tripIDs:    list("trip_id"),
+		vehicleIDs: list("vehicle_id"),
+		stopIDs:    list("stop_id"),
+	}
+
+	if value := c.Query("direction_id"); value != "" {
+		directionID, err := strconv.Atoi(value)
+		if err != nil || (directionID != 0 && directionID != 1) {
+			return filter, fmt.Errorf("direction_id must be 0 or 1")
+		}
+		filter.directionID = &directionID
+	}
+
+	if value := c.Query("bbox"); value != "" {
+		minLat, minLon, maxLat, maxLon, err := parseBoundingBox(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.bbox = &[4]float64{minLat, minLon, maxLat, maxLon}
+	}
+
+	if value := c.Query("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return filter, fmt.Errorf("max_age must be a positive number of seconds")
+		}
+		filter.maxAge = time.Duration(seconds) * time.Second
+	}
+
+	return filter, nil
+}
+
+func (s *feedSnapshot) index() *snapshotIndex {
+	s.indexOnce.Do(func() {
+		idx := &snapshotIndex{
+			byRoute:     make(map[string][]int),
+			byTrip:      make(map[string][]int),
+			byVehicle:   make(map[string][]int),
+			byStop:      make(map[string][]int),
+			byDirection: make(map[int][]int),
+		}
+		add := func(m map[string][]int, key string, i int) {
+			if key != "" && (len(m[key]) == 0 || m[key][len(m[key])-1] != i) {
+				m[key] = append(m[key], i)
+			}
+		}
+
+		for i, entity := range s.feed.Entity {
+			var trip *gtfs.TripDescriptor
+			switch {
+			case entity.Vehicle != nil:
+				trip = entity.Vehicle.GetTrip()
+				add(idx.byVehicle, entity.Vehicle.GetVehicle().GetId(), i)
+				add(idx.byStop, entity.Vehicle.GetStopId(), i)
+			case entity.TripUpdate != nil:
+				trip = entity.TripUpdate.GetTrip()
+				add(idx.byVehicle, entity.TripUpdate.GetVehicle().GetId(), i)
+				for _, stu := range entity.TripUpdate.StopTimeUpdate {
+					add(idx.byStop, stopTimeUpdateStopID(trip.GetTripId(), stu), i)
+				}
+			default:
+				continue
+			}
+
+			// feeds often leave route and direction to the static schedule
+			routeID, directionID := trip.GetRouteId(), int(trip.GetDirectionId())
+			static, found := findTripByID(trip.GetTripId())
+			if routeID == "" && found {
+				routeID = static.RouteID
+			}
+			if trip.DirectionId == nil && found {
+				directionID = static.DirectionID
+			}
+			add(idx.byTrip, trip.GetTripId(), i)
+			add(idx.byRoute, routeID, i)
+			if trip.DirectionId != nil || found {
+				idx.byDirection[directionID] = append(idx.byDirection[directionID], i)
+			}
+		}
+		s.indexed = idx
+	})
+	return s.indexed
+}
+
+// stopTimeUpdateStopID returns the stop an update refers to, looking it up
+// by stop_sequence in the schedule when stop_id is missing.
+func stopTimeUpdateStopID(tripID string, stu *gtfs.TripUpdate_StopTimeUpdate) string {
+	if stu.GetStopId() != "" || stu.StopSequence == nil {
+		return stu.GetStopId()
+	}
+	stopTimes, _ := findStopTimesByTripID(tripID)
+	for _, st := range stopTimes {
+		if st.StopSequence == int(stu.GetStopSequence()) {
+			return st.StopID
+		}
+	}
+	return ""
+}
+
+// entities returns the snapshot's entities that pass the filter, in feed
+// order. Each list filter keeps entities matching any of its values and
+// all filters must hold.
+func (s *feedSnapshot) entities(filter realtimeFilter) []*gtfs.FeedEntity {
+	idx := s.index()
+
+	var candidates []int
+	restricted := false
+	narrow := func(positions []int) {
+		if !restricted {
+			candidates, restricted = positions, true
+			return
+		}
+		keep := make(map[int]bool, len(positions))
+		for _, i := range positions {
+			keep[i] = true
+		}
+		var narrowed []int
+		for _, i := range candidates {
+			if keep[i] {
+				narrowed = append(narrowed, i)
+			}
+		}
+		candidates = narrowed
+	}
+	union := func(m map[string][]int, keys []string) []int {
+		seen := make(map[int]bool)
+		var positions []int
+		for _, key := range keys {
+			for _, i := range m[key] {
+				if !seen[i] {
+					seen[i] = true
+					positions = append(positions, i)
+				}
+			}
+		}
+		sort.Ints(positions)
+		return positions
+	}
+
+	if len(filter.routeIDs) > 0 {
+		narrow(union(idx.byRoute, filter.routeIDs))
+	}
+	if len(filter.tripIDs) > 0 {
+		narrow(union(idx.byTrip, filter.tripIDs))
+	}
+	if len(filter.vehicleIDs) > 0 {
+		narrow(union(idx.byVehicle, filter.vehicleIDs))
+	}
+	if len(filter.stopIDs) > 0 {
+		narrow(union(idx.byStop, filter.stopIDs))
+	}
+	if filter.directionID != nil {
+		narrow(idx.byDirection[*filter.directionID])
+	}
+	if !restricted {
+		candidates = make([]int, len(s.feed.Entity))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	cutoff := time.Time{}
+	if filter.maxAge > 0 {
+		cutoff = clockNow().Add(-filter.maxAge)
+	}
+
+	entities := []*gtfs.FeedEntity{}
+	for _, i := range candidates {
+		entity := s.feed.Entity[i]
+		if entity.Vehicle == nil && entity.TripUpdate == nil && (restricted || filter.bbox != nil || filter.maxAge > 0) {
+			continue
+		}
+		if filter.bbox != nil && !entityWithin(entity, filter.bbox) {
+			continue
+		}
+		if !cutoff.IsZero() && s.entityTime(entity).Before(cutoff) {
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// entityTime is when the entity was last measured, falling back to the
+// feed header when the entity has no timestamp of its own.
+func (s *feedSnapshot) entityTime(entity *gtfs.FeedEntity) time.Time {
+	var ts uint64
+	switch {
+	case entity.Vehicle != nil:
+		ts = entity.Vehicle.GetTimestamp()
+	case entity.TripUpdate != nil:
+		ts = entity.TripUpdate.GetTimestamp()
+	}
+	if ts == 0 {
+		return s.timestamp()
+	}
+	return time.Unix(int64(ts), 0)
+}
+
+// entityWithin tests a vehicle's position, or for a trip update whether
+// any of the stops it updates lies in the box.
+func entityWithin(entity *gtfs.FeedEntity, bbox *[4]float64) bool {
+	inside := func(lat, lon float64) bool {
+		return lat >= bbox[0] && lat <= bbox[2] && lon >= bbox[1] && lon <= bbox[3]
+	}
+
+	if entity.Vehicle != nil {
+		position := entity.Vehicle.GetPosition()
+		return position != nil && inside(float64(position.GetLatitude()), float64(position.GetLongitude()))
+	}
+	if entity.TripUpdate != nil {
+		tripID := entity.TripUpdate.GetTrip().GetTripId()
+		for _, stu := range entity.TripUpdate.StopTimeUpdate {
+			if stop, ok := findStopById(stopTimeUpdateStopID(tripID, stu)); ok && inside(stop.StopLat, stop.StopLon) {
+				return true
+			}
+		}
+	}
+	return false
+}
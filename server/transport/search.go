@@ -0,0 +1,298 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// abbreviations maps the short forms used in stop and route names to the
+// word they stand for. Both sides are indexed so either spelling matches.
+var abbreviations = map[string]string{
+	"st":   "street",
+	"stn":  "station",
+	"sta":  "station",
+	"ave":  "avenue",
+	"av":   "avenue",
+	"blvd": "boulevard",
+	"rd":   "road",
+	"dr":   "drive",
+	"pkwy": "parkway",
+	"hwy":  "highway",
+	"pl":   "place",
+	"ct":   "court",
+	"cir":  "circle",
+	"ln":   "lane",
+	"ctr":  "center",
+	"pnr":  "parkandride",
+	"mt":   "mount",
+	"univ": "university",
+	"n":    "north",
+	"s":    "south",
+	"e":    "east",
+	"w":    "west",
+}
+
+type searchDoc struct {
+	result processing.SearchResult
+	tokens []string
+	code   string
+	weight float64
+}
+
+type searchIndex struct {
+	docs     []searchDoc
+	postings map[string][]int // token -> doc indexes
+	vocab    []string
+}
+
+var SearchIndex = &searchIndex{postings: make(map[string][]int)}
+
+// InitSearchIndex indexes stop names and codes, route names and trip
+// headsigns. It needs stops, routes and trips to be loaded.
+func InitSearchIndex() {
+	index := &searchIndex{postings: make(map[string][]int)}
+
+	for _, stop := range StopsMap {
+		index.add(searchDoc{
+			result: processing.SearchResult{
+				Type:        "stop",
+				ID:          stop.StopID,
+				Name:        stop.StopName,
+				Description: stop.StopDesc,
+				StopLat:     stop.StopLat,
+				StopLon:     stop.StopLon,
+			},
+			tokens: searchTokens(stop.StopName),
+			code:   strings.ToLower(stop.StopCode),
+			weight: 1.0,
+		})
+	}
+
+	for _, route := range RoutesMap {
+		index.add(searchDoc{
+			result: processing.SearchResult{
+				Type:        "route",
+				ID:          route.RouteID,
+				Name:        strings.TrimSpace(route.RouteShortName + " " + route.RouteLongName),
+				Description: route.RouteDesc,
+				RouteColor:  route.RouteColor,
+			},
+			tokens: searchTokens(route.RouteShortName + " " + route.RouteLongName),
+			code:   strings.ToLower(route.RouteShortName),
+			weight: 1.2,
+		})
+	}
+
+	headsignRoutes := make(map[string]map[string]bool)
+	for _, trip := range TripsMap {
+		if trip.TripHeadsign == "" {
+			continue
+		}
+		if headsignRoutes[trip.TripHeadsign] == nil {
+			headsignRoutes[trip.TripHeadsign] = make(map[string]bool)
+		}
+		headsignRoutes[trip.TripHeadsign][trip.RouteID] = true
+	}
+	for headsign, routes := range headsignRoutes {
+		routeIDs := make([]string, 0, len(routes))
+		for routeID := range routes {
+			routeIDs = append(routeIDs, routeID)
+		}
+		sort.Strings(routeIDs)
+		index.add(searchDoc{
+			result: processing.SearchResult{
+				Type:     "headsign",
+				ID:       headsign,
+				Name:     headsign,
+				RouteIDs: routeIDs,
+			},
+			tokens: searchTokens(headsign),
+			weight: 0.8,
+		})
+	}
+
+	for token := range index.postings {
+		index.vocab = append(index.vocab, token)
+	}
+	sort.Strings(index.vocab)
+
+	SearchIndex = index
+	fmt.Printf("SearchIndex initialized with %d documents and %d terms\n", len(index.docs), len(index.vocab))
+}
+
+func (s *searchIndex) add(doc searchDoc) {
+	id := len(s.docs)
+	s.docs = append(s.docs, doc)
+	seen := make(map[string]bool)
+	for _, token := range doc.tokens {
+		if !seen[token] {
+			seen[token] = true
+			s.postings[token] = append(s.postings[token], id)
+		}
+	}
+}
+
+// searchTokens lowercases text, splits it on anything that is not a letter
+// or digit and expands abbreviations.
+func searchTokens(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if expanded, ok := abbreviations[field]; ok {
+			tokens = append(tokens, expanded)
+			continue
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+// maxTypos allows one edit for medium words and two for long ones, short
+// words must match exactly or as a prefix.
+func maxTypos(token string) int {
+	switch n := len([]rune(token)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// termMatches returns the indexed terms that match a query token with the
+// score each earns: exact 1.0, prefix 0.8, within the typo budget 0.6.
+func (s *searchIndex) termMatches(token string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := s.postings[token]; ok {
+		matches[token] = 1.0
+	}
+
+	start := sort.SearchStrings(s.vocab, token)
+	for i := start; i < len(s.vocab) && strings.HasPrefix(s.vocab[i], token); i++ {
+		if _, ok := matches[s.vocab[i]]; !ok {
+			matches[s.vocab[i]] = 0.8
+		}
+	}
+
+	if budget := maxTypos(token); budget > 0 {
+		for _, term := range s.vocab {
+			if _, ok := matches[term]; ok {
+				continue
+			}
+			if abs(len(term)-len(token)) > budget {
+				continue
+			}
+			if editDistance(token, term) <= budget {
+				matches[term] = 0.6
+			}
+		}
+	}
+	return matches
+}
+
+// search ranks documents by how well every query token matches. Documents
+// must match all tokens; exact stop code or route number hits rank first.
+func (s *searchIndex) search(query string, kinds map[string]bool, limit int) []processing.SearchResult {
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return []processing.SearchResult{}
+	}
+	raw := strings.ToLower(strings.TrimSpace(query))
+
+	scores := make(map[int]float64)
+	for i, token := range tokens {
+		best := make(map[int]float64)
+		for term, score := range s.termMatches(token) {
+			for _, doc := range s.postings[term] {
+				if score > best[doc] {
+					best[doc] = score
+				}
+			}
+		}
+		if i == 0 {
+			scores = best
+			continue
+		}
+		for doc := range scores {
+			if score, ok := best[doc]; ok {
+				scores[doc] += score
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	for i, doc := range s.docs {
+		if doc.code != "" && doc.code == raw {
+			scores[i] += float64(len(tokens)) + 1
+		}
+	}
+
+	results := make([]processing.SearchResult, 0, len(scores))
+	for i, score := range scores {
+		doc := s.docs[i]
+		if len(kinds) > 0 && !kinds[doc.result.Type] {
+			continue
+		}
+		// favour names that are mostly covered by the query
+		coverage := float64(len(tokens)) / float64(len(doc.tokens)+len(tokens))
+		result := doc.result
+		result.Score = (score/float64(len(tokens)) + 0.25*coverage) * doc.weight
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].ID < results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// editDistance is the optimal string alignment distance, counting adjacent
+// transpositions as a single edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
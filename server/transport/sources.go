@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultFetchTimeout = 10 * time.Second
+
+// feedSource says where one GTFS-RT feed comes from. http(s) sources may
+// carry extra headers and an API key sent as a query parameter. file://
+// sources read a local .pb file on every fetch, or step through the .pb
+// files of a directory in name order, so a stand-in or a recording can
+// drive the server.
+type feedSource struct {
+	name        string
+	envPrefix   string
+	url         string
+	headers     http.Header
+	apiKeyParam string
+	apiKey      string
+	timeout     time.Duration
+	archive     *feedArchive // set in replay mode, replaces the url
+
+	mu   sync.Mutex
+	next int // position in a directory source
+}
+
+var alertsSource = &feedSource{name: "Alerts", envPrefix: "ALERTS", url: rtdAlerts, timeout: defaultFetchTimeout}
+var tripUpdatesSource = &feedSource{name: "TripUpdates", envPrefix: "TRIP_UPDATES", url: rtdTripUpdates, timeout: defaultFetchTimeout}
+var vehiclePositionsSource = &feedSource{name: "VehiclePositions", envPrefix: "VEHICLE_POSITIONS", url: rtdVehiclePosition, timeout: defaultFetchTimeout}
+
+// LoadRealtimeSources configures the feeds from the environment. For each
+// of the ALERTS, TRIP_UPDATES and VEHICLE_POSITIONS prefixes:
+//
+//	<PREFIX>_URL            http(s):// or file:// source, RTD's feed by default
+//	<PREFIX>_HEADERS        extra request headers, "Name: value|Name: value"
+//	<PREFIX>_API_KEY        key added to the query string
+//	<PREFIX>_API_KEY_PARAM  its parameter name, "api_key" by default
+//	<PREFIX>_TIMEOUT        request timeout such as "5s"
+//
+// GTFSRT_HEADERS, GTFSRT_API_KEY, GTFSRT_API_KEY_PARAM and GTFSRT_TIMEOUT
+// apply to every feed that does not set its own.
+func LoadRealtimeSources() error {
+	for _, source := range []*feedSource{alertsSource, tripUpdatesSource, vehiclePositionsSource} {
+		lookup := func(suffix string) string {
+			if value := os.Getenv(source.envPrefix + "_" + suffix); value != "" {
+				return value
+			}
+			return os.Getenv("GTFSRT_" + suffix)
+		}
+
+		if value := os.Getenv(source.envPrefix + "_URL"); value != "" {
+			source.url = value
+		}
+		parsed, err := url.Parse(source.url)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "file") {
+			return fmt.Errorf("%s_URL must be an http, https or file URL, got %q", source.envPrefix, source.url)
+		}
+
+		headers, err := parseHeaders(lookup("HEADERS"))
+		if err != nil {
+			return fmt.Errorf("%s_HEADERS: %w", source.envPrefix, err)
+		}
+		source.headers = headers
+
+		source.apiKey = lookup("API_KEY")
+		source.apiKeyParam = lookup("API_KEY_PARAM")
+		if source.apiKeyParam == "" {
+			source.apiKeyParam = "api_key"
+		}
+
+		if value := lookup("TIMEOUT"); value != "" {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("%s_TIMEOUT must be a positive duration, got %q", source.envPrefix, value)
+			}
+			source.timeout = timeout
+		}
+
+		fmt.Printf("%s source: %s\n", source.name, source.describe())
+	}
+	return nil
+}
+
+// parseHeaders reads "Name: value" pairs separated by "|".
+func parseHeaders(value string) (http.Header, error) {
+	headers := make(http.Header)
+	if strings.TrimSpace(value) == "" {
+		return headers, nil
+	}
+	for _, pair := range strings.Split(value, "|") {
+		name, headerValue, found := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("expected \"Name: value\", got %q", pair)
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
+
+// describe names the source for logs without leaking credentials.
+func (s *feedSource) describe() string {
+	description := s.url
+	if len(s.headers) > 0 {
+		names := make([]string, 0, len(s.headers))
+		for name := range s.headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		description += fmt.Sprintf(" with headers %s", strings.Join(names, ", "))
+	}
+	if s.apiKey != "" {
+		description += fmt.Sprintf(" with api key in %q", s.apiKeyParam)
+	}
+	if !strings.HasPrefix(s.url, "file:") {
+		description += fmt.Sprintf(" (timeout %s)", s.timeout)
+	}
+	return description
+}
+
+func (s *feedSource) read() ([]byte, error) {
+	if s.archive != nil {
+		return s.archive.read(clockNow())
+	}
+	parsed, err := url.Parse(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	if parsed.Scheme == "file" {
+		return s.readFile(parsed)
+	}
+	return s.readHTTP(parsed)
+}
+
+func (s *feedSource) readHTTP(parsed *url.URL) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if s.apiKey != "" {
+		query := parsed.Query()
+		query.Set(s.apiKeyParam, s.apiKey)
+		parsed.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range s.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the error quotes the URL, keep the key out of it
+		if s.apiKey != "" {
+			return nil, fmt.Errorf("failed to fetch GTFS-RT feed: %s", strings.ReplaceAll(err.Error(), url.QueryEscape(s.apiKey), "REDACTED"))
+		}
+		return nil, fmt.Errorf("failed to fetch GTFS-RT feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response status: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GTFS-RT data: %w", err)
+	}
+	return data, nil
+}
+
+// readFile accepts file:///absolute/path and file://relative/path.
+func (s *feedSource) readFile(parsed *url.URL) ([]byte, error) {
+	path := parsed.Host + parsed.Path
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GTFS-RT file: %w", err)
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.pb"))
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("no .pb files in %s", path)
+	}
+	sort.Strings(files)
+
+	s.mu.Lock()
+	file := files[s.next%len(files)]
+	s.next = (s.next + 1) % len(files)
+	s.mu.Unlock()
+
+	return os.ReadFile(file)
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusMeters = 6371008.8
+
+// stopGridCellDegrees is roughly 1.1km north-south at Denver's latitude.
+const stopGridCellDegrees = 0.01
+
+const maxNearbyRadius = 5000.0
+
+// gridIndex buckets points into fixed size lat/lon cells so radius and
+// bounding box queries only visit nearby cells instead of every point.
+type gridIndex struct {
+	cellSize float64
+	cells    map[gridCell][]gridPoint
+}
+
+type gridCell struct {
+	row int
+	col int
+}
+
+type gridPoint struct {
+	id  string
+	lat float64
+	lon float64
+}
+
+func newGridIndex(cellSize float64) *gridIndex {
+	return &gridIndex{cellSize: cellSize, cells: make(map[gridCell][]gridPoint)}
+}
+
+func (g *gridIndex) cellFor(lat, lon float64) gridCell {
+	return gridCell{row: int(math.Floor(lat / g.cellSize)), col: int(math.Floor(lon / g.cellSize))}
+}
+
+func (g *gridIndex) insert(id string, lat, lon float64) {
+	cell := g.cellFor(lat, lon)
+	g.cells[cell] = append(g.cells[cell], gridPoint{id: id, lat: lat, lon: lon})
+}
+
+// within returns the points inside the bounding box. A box spanning more
+// cells than the index holds walks the populated cells instead, so a huge
+// box costs no more than a full scan.
+func (g *gridIndex) within(minLat, minLon, maxLat, maxLon float64) []gridPoint {
+	minLat, maxLat = math.Max(minLat, -90), math.Min(maxLat, 90)
+	minLon, maxLon = math.Max(minLon, -180), math.Min(maxLon, 180)
+	if !(minLat <= maxLat && minLon <= maxLon) {
+		return nil
+	}
+	low := g.cellFor(minLat, minLon)
+	high := g.cellFor(maxLat, maxLon)
+
+	var points []gridPoint
+	collect := func(cell []gridPoint) {
+		for _, p := range cell {
+			if p.lat >= minLat && p.lat <= maxLat && p.lon >= minLon && p.lon <= maxLon {
+				points = append(points, p)
+			}
+		}
+	}
+
+	if (high.row-low.row+1)*(high.col-low.col+1) > len(g.cells) {
+		for cell, cellPoints := range g.cells {
+			if cell.row >= low.row && cell.row <= high.row && cell.col >= low.col && cell.col <= high.col {
+				collect(cellPoints)
+			}
+		}
+		return points
+	}
+	for row := low.row; row <= high.row; row++ {
+		for col := low.col; col <= high.col; col++ {
+			collect(g.cells[gridCell{row: row, col: col}])
+		}
+	}
+	return points
+}
+
+// nearby returns the points within radius meters, closest first.
+func (g *gridIndex) nearby(lat, lon, radius float64) []gridPoint {
+	minLat, minLon, maxLat, maxLon := boundingBox(lat, lon, radius)
+
+	type ranked struct {
+		point    gridPoint
+		distance float64
+	}
+	var candidates []ranked
+	for _, p := range g.within(minLat, minLon, maxLat, maxLon) {
+		if d := haversineMeters(lat, lon, p.lat, p.lon); d <= radius {
+			candidates = append(candidates, ranked{point: p, distance: d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	points := make([]gridPoint, len(candidates))
+	for i, c := range candidates {
+		points[i] = c.point
+	}
+	return points
+}
+
+// boundingBox returns the box enclosing a circle of radius meters.
+func boundingBox(lat, lon, radius float64) (minLat, minLon, maxLat, maxLon float64) {
+	dLat := radius / earthRadiusMeters * 180 / math.Pi
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	return lat - dLat, lon - dLon, lat + dLat, lon + dLon
+}
+
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+var StopsIndex = newGridIndex(stopGridCellDegrees)
+
+func InitStopsIndex() {
+	for _, stop := range StopsMap {
+		StopsIndex.insert(stop.StopID, stop.StopLat, stop.StopLon)
+	}
+	fmt.Printf("StopsIndex initialized with %d stops in %d cells\n", len(StopsMap), len(StopsIndex.cells))
+}
+
+// findStopsNearby returns stops within radius meters of a point, closest first.
+func findStopsNearby(lat, lon, radius float64) []processing.NearbyStop {
+	var stops []processing.NearbyStop
+	for _, p := range StopsIndex.nearby(lat, lon, radius) {
+		if stop, ok := findStopById(p.id); ok {
+			stops = append(stops, processing.NearbyStop{
+				Stop:          stop,
+				Distance:      haversineMeters(lat, lon, p.lat, p.lon),
+				Accessibility: wheelchairLabel(stopWheelchairBoarding(stop)),
+			})
+		}
+	}
+	return stops
+}
+
+// findStopsWithin returns the stops inside a bounding box.
+func findStopsWithin(minLat, minLon, maxLat, maxLon float64) []processing.Stop {
+	var stops []processing.Stop
+	for _, p := range StopsIndex.within(minLat, minLon, maxLat, maxLon) {
+		if stop, ok := findStopById(p.id); ok {
+			stops = append(stops, stop)
+		}
+	}
+	return stops
+}
+
+// parseBoundingBox reads a GeoJSON ordered "min_lon,min_lat,max_lon,max_lat".
+func parseBoundingBox(value string) (minLat, minLon, maxLat, maxLon float64, err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("bbox must be formatted as min_lon,min_lat,max_lon,max_lat")
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		coords[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(coords[i]) || math.IsInf(coords[i], 0) {
+			return 0, 0, 0, 0, fmt.Errorf("bbox must be formatted as min_lon,min_lat,max_lon,max_lat")
+		}
+	}
+	minLon, minLat, maxLon, maxLat = coords[0], coords[1], coords[2], coords[3]
+	if minLat > maxLat || minLon > maxLon {
+		return 0, 0, 0, 0, fmt.Errorf("bbox minimums must not exceed maximums")
+	}
+	// a box larger than the world covers the world
+	minLat, maxLat = math.Max(minLat, -90), math.Min(maxLat, 90)
+	minLon, maxLon = math.Max(minLon, -180), math.Min(maxLon, 180)
+	if minLat > maxLat || minLon > maxLon {
+		return 0, 0, 0, 0, fmt.Errorf("bbox lies outside the valid coordinate range")
+	}
+	return minLat, minLon, maxLat, maxLon, nil
+}
@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGridIndexWithinHugeBox(t *testing.T) {
+	g := newGridIndex(stopGridCellDegrees)
+	g.insert("a", 39.74, -104.99)
+	g.insert("b", 39.75, -105.00)
+
+	if got := len(g.within(-1e9, -1e9, 1e9, 1e9)); got != 2 {
+		t.Errorf("world sized box found %d points, want 2", got)
+	}
+	if got := len(g.within(39.745, -105.01, 39.76, -104.995)); got != 1 {
+		t.Errorf("small box found %d points, want 1", got)
+	}
+	if got := len(g.within(math.NaN(), -105, 40, -104)); got != 0 {
+		t.Errorf("NaN box found %d points, want 0", got)
+	}
+}
+
+func TestParseBoundingBox(t *testing.T) {
+	for _, value := range []string{"NaN,0,1,1", "0,0,Inf,1", "-Inf,0,1,1", "1,0,0,1", "0,100,1,120"} {
+		if _, _, _, _, err := parseBoundingBox(value); err == nil {
+			t.Errorf("%q was accepted", value)
+		}
+	}
+
+	minLat, minLon, maxLat, maxLon, err := parseBoundingBox("-1e9,-1e9,1e9,1e9")
+	if err != nil || minLat != -90 || minLon != -180 || maxLat != 90 || maxLon != 180 {
+		t.Errorf("got %v,%v,%v,%v %v, want the world", minLat, minLon, maxLat, maxLon, err)
+	}
+}
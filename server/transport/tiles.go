@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/mvt"
+	"go-octo-eureka/server/processing"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// stopsMinZoom hides the stops layer on zoomed out tiles where thousands of
+// points would only clutter the map.
+const stopsMinZoom = 12
+
+// tileBuffer is how far, in tile units, geometry may spill past the tile
+// edge so lines and symbols do not get cut at the seams.
+const tileBuffer = 64
+
+type routeLine struct {
+	route  processing.Route
+	shape  string
+	points [][2]float64 // web mercator world coordinates
+	minX   float64
+	minY   float64
+	maxX   float64
+	maxY   float64
+}
+
+var routeLines []routeLine
+
+// InitVectorTiles projects every route's pattern shapes into web mercator
+// once, so tile requests only need to clip. It must run after InitPatterns.
+func InitVectorTiles() {
+	for routeID, patterns := range RoutePatternsMap {
+		route, ok := findRouteByID(routeID)
+		if !ok {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, pattern := range patterns {
+			if pattern.ShapeID == "" || seen[pattern.ShapeID] {
+				continue
+			}
+			seen[pattern.ShapeID] = true
+
+			shape, ok := findShapeById(pattern.ShapeID)
+			if !ok || len(shape) < 2 {
+				continue
+			}
+
+			line := routeLine{route: route, shape: pattern.ShapeID, minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+			for _, pt := range sortedShape(shape) {
+				x, y := mvt.Mercator(pt.ShapePtLat, pt.ShapePtLon)
+				line.points = append(line.points, [2]float64{x, y})
+				line.minX, line.maxX = math.Min(line.minX, x), math.Max(line.maxX, x)
+				line.minY, line.maxY = math.Min(line.minY, y), math.Max(line.maxY, y)
+			}
+			routeLines = append(routeLines, line)
+		}
+	}
+	fmt.Printf("Vector tiles initialized with %d route shapes\n", len(routeLines))
+}
+
+// sortedShape returns the shape points ordered by shape_pt_sequence.
+func sortedShape(shape []processing.Shape) []processing.Shape {
+	sorted := make([]processing.Shape, len(shape))
+	copy(sorted, shape)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ShapePtSequence < sorted[j].ShapePtSequence
+	})
+	return sorted
+}
+
+// buildTile renders the requested layers for tile z/x/y.
+func buildTile(z, x, y int, layers map[string]bool, vehicles []processing.VehiclePositionEntity) *mvt.Tile {
+	tile := &mvt.Tile{}
+
+	if layers["routes"] {
+		if layer := routesLayer(z, x, y); layer.Len() > 0 {
+			tile.Layers = append(tile.Layers, layer)
+		}
+	}
+	if layers["stops"] && z >= stopsMinZoom {
+		if layer := stopsLayer(z, x, y); layer.Len() > 0 {
+			tile.Layers = append(tile.Layers, layer)
+		}
+	}
+	if layers["vehicles"] {
+		if layer := vehiclesLayer(z, x, y, vehicles); layer.Len() > 0 {
+			tile.Layers = append(tile.Layers, layer)
+		}
+	}
+
+	return tile
+}
+
+func routesLayer(z, x, y int) *mvt.Layer {
+	layer := mvt.NewLayer("routes")
+	n := math.Exp2(float64(z))
+	pad := float64(tileBuffer) / float64(layer.Extent) / n
+	tileMinX, tileMinY := float64(x)/n-pad, float64(y)/n-pad
+	tileMaxX, tileMaxY := float64(x+1)/n+pad, float64(y+1)/n+pad
+
+	for _, line := range routeLines {
+		if line.maxX < tileMinX || line.minX > tileMaxX || line.maxY < tileMinY || line.minY > tileMaxY {
+			continue
+		}
+
+		// keep runs of segments touching the buffered tile
+		var parts [][]mvt.Point
+		var current []mvt.Point
+		for i := 1; i < len(line.points); i++ {
+			a, b := line.points[i-1], line.points[i]
+			if math.Max(a[0], b[0]) < tileMinX || math.Min(a[0], b[0]) > tileMaxX ||
+				math.Max(a[1], b[1]) < tileMinY || math.Min(a[1], b[1]) > tileMaxY {
+				if len(current) > 0 {
+					parts = append(parts, current)
+					current = nil
+				}
+				continue
+			}
+			if len(current) == 0 {
+				current = append(current, mvt.Project(a[0], a[1], z, x, y, layer.Extent))
+			}
+			current = append(current, mvt.Project(b[0], b[1], z, x, y, layer.Extent))
+		}
+		if len(current) > 0 {
+			parts = append(parts, current)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		layer.AddLineStrings(featureID(line.route.RouteID+":"+line.shape), parts, map[string]interface{}{
+			"route_id":         line.route.RouteID,
+			"route_short_name": line.route.RouteShortName,
+			"route_long_name":  line.route.RouteLongName,
+			"route_type":       line.route.RouteType,
+			"route_color":      "#" + line.route.RouteColor,
+			"route_text_color": "#" + line.route.RouteTextColor,
+			"shape_id":         line.shape,
+		})
+	}
+	return layer
+}
+
+func stopsLayer(z, x, y int) *mvt.Layer {
+	layer := mvt.NewLayer("stops")
+	minLat, minLon, maxLat, maxLon := bufferedTileBounds(z, x, y, layer.Extent)
+
+	for _, stop := range findStopsWithin(minLat, minLon, maxLat, maxLon) {
+		wx, wy := mvt.Mercator(stop.StopLat, stop.StopLon)
+		layer.AddPoint(featureID(stop.StopID), mvt.Project(wx, wy, z, x, y, layer.Extent), map[string]interface{}{
+			"stop_id":             stop.StopID,
+			"stop_code":           stop.StopCode,
+			"stop_name":           stop.StopName,
+			"location_type":       stop.LocationType,
+			"wheelchair_boarding": stop.WheelchairBoarding,
+		})
+	}
+	return layer
+}
+
+func vehiclesLayer(z, x, y int, vehicles []processing.VehiclePositionEntity) *mvt.Layer {
+	layer := mvt.NewLayer("vehicles")
+	minLat, minLon, maxLat, maxLon := bufferedTileBounds(z, x, y, layer.Extent)
+
+	for _, v := range vehicles {
+		pos := v.Vehicle.Position
+		if pos.Latitude < minLat || pos.Latitude > maxLat || pos.Longitude < minLon || pos.Longitude > maxLon {
+			continue
+		}
+		properties := map[string]interface{}{
+			"vehicle_id": v.Vehicle.Vehicle.ID,
+			"label":      v.Vehicle.Vehicle.Label,
+			"trip_id":    v.Vehicle.Trip.TripID,
+			"route_id":   v.Vehicle.Trip.RouteID,
+			"bearing":    pos.Bearing,
+			"timestamp":  v.Vehicle.Timestamp,
+		}
+		if route, ok := findRouteByID(v.Vehicle.Trip.RouteID); ok {
+			properties["route_color"] = "#" + route.RouteColor
+		}
+		wx, wy := mvt.Mercator(pos.Latitude, pos.Longitude)
+		layer.AddPoint(featureID(v.ID), mvt.Project(wx, wy, z, x, y, layer.Extent), properties)
+	}
+	return layer
+}
+
+func bufferedTileBounds(z, x, y int, extent uint32) (minLat, minLon, maxLat, maxLon float64) {
+	minLat, minLon, maxLat, maxLon = mvt.TileBounds(z, x, y)
+	padLat := (maxLat - minLat) * tileBuffer / float64(extent)
+	padLon := (maxLon - minLon) * tileBuffer / float64(extent)
+	return minLat - padLat, minLon - padLon, maxLat + padLat, maxLon + padLon
+}
+
+// featureID derives a stable numeric feature id from a GTFS id.
+func featureID(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"encoding/csv"
+	"go-octo-eureka/server/processing"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// buildTimetable lays out the trips of a route and direction on a service
+// date as rows, with the timepoint stops as columns. Trips without any
+// timepoint contribute all their timed stops instead.
+func buildTimetable(route processing.Route, directionID int, date time.Time) processing.Timetable {
+	type timedTrip struct {
+		trip      processing.Trip
+		start     int
+		stopTimes []processing.StopTime
+	}
+
+	var trips []timedTrip
+	for _, trip := range routeTripsOn(route.RouteID, date) {
+		if trip.DirectionID != directionID {
+			continue
+		}
+		stopTimes, _ := findStopTimesByTripID(trip.TripID)
+
+		var timepoints []processing.StopTime
+		for _, st := range stopTimes {
+			if st.Timepoint == 1 {
+				timepoints = append(timepoints, st)
+			}
+		}
+		if len(timepoints) == 0 {
+			// a trip that marks no timepoints still shows, with every stop
+			// it has a time for
+			for _, st := range stopTimes {
+				if st.DepartureTime != "" {
+					timepoints = append(timepoints, st)
+				}
+			}
+		}
+		if len(timepoints) == 0 {
+			continue
+		}
+
+		start, _ := processing.ParseGTFSTime(timepoints[0].DepartureTime)
+		trips = append(trips, timedTrip{trip: trip, start: start, stopTimes: timepoints})
+	}
+
+	sort.SliceStable(trips, func(i, j int) bool {
+		return trips[i].start < trips[j].start
+	})
+
+	sequences := make([][]string, len(trips))
+	for i, t := range trips {
+		for _, st := range t.stopTimes {
+			sequences[i] = append(sequences[i], st.StopID)
+		}
+	}
+	columns := mergeStopSequences(sequences)
+
+	timetable := processing.Timetable{
+		RouteID:        route.RouteID,
+		RouteShortName: route.RouteShortName,
+		RouteLongName:  route.RouteLongName,
+		DirectionID:    directionID,
+		ServiceDate:    date.Format(serviceDateLayout),
+		Stops:          make([]processing.TimetableStop, 0, len(columns)),
+		Trips:          make([]processing.TimetableRow, 0, len(trips)),
+	}
+
+	for _, stopID := range columns {
+		column := processing.TimetableStop{StopID: stopID}
+		if stop, ok := findStopById(stopID); ok {
+			column.StopName = stop.StopName
+		}
+		timetable.Stops = append(timetable.Stops, column)
+	}
+
+	for _, t := range trips {
+		row := processing.TimetableRow{
+			TripID:       t.trip.TripID,
+			TripHeadsign: t.trip.TripHeadsign,
+			Times:        make([]string, len(columns)),
+		}
+		pos := 0
+		for _, st := range t.stopTimes {
+			if idx := indexFrom(columns, st.StopID, pos); idx >= 0 {
+				row.Times[idx] = st.DepartureTime
+				pos = idx + 1
+			}
+		}
+		timetable.Trips = append(timetable.Trips, row)
+	}
+
+	return timetable
+}
+
+func writeTimetableCSV(w io.Writer, timetable processing.Timetable) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"trip_id", "trip_headsign"}
+	for _, stop := range timetable.Stops {
+		header = append(header, stop.StopName+" ("+stop.StopID+")")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range timetable.Trips {
+		record := append([]string{row.TripID, row.TripHeadsign}, row.Times...)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+var timetableTemplate = template.Must(template.New("timetable").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Route {{.RouteShortName}} {{.RouteLongName}} - {{.ServiceDate}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-size: 12px; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: center; }
+th { background: #f0f0f0; }
+tr:nth-child(even) td { background: #fafafa; }
+</style>
+</head>
+<body>
+<h1>Route {{.RouteShortName}} {{.RouteLongName}}</h1>
+<p>Direction {{.DirectionID}}, service date {{.ServiceDate}}</p>
+<table>
+<thead>
+<tr><th>Headsign</th>{{range .Stops}}<th>{{.StopName}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{range .Trips}}<tr><td>{{.TripHeadsign}}</td>{{range .Times}}<td>{{if .}}{{.}}{{else}}&mdash;{{end}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+func writeTimetableHTML(w io.Writer, timetable processing.Timetable) error {
+	return timetableTemplate.Execute(w, timetable)
+}
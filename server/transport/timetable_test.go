@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"go-octo-eureka/server/processing"
+	"testing"
+)
+
+func TestBuildTimetableTripWithoutTimepoints(t *testing.T) {
+	loadTestTrip(t, "marked", 3)
+	loadTestTrip(t, "unmarked", 3)
+	for _, tripID := range []string{"marked", "unmarked"} {
+		trip := TripsMap[tripID]
+		trip.ServiceID = "daily"
+		TripsMap[tripID] = trip
+	}
+	// only the first and last stops of one trip are timepoints
+	TripStopTimesMap["marked"][0].Timepoint = 1
+	TripStopTimesMap["marked"][2].Timepoint = 1
+	CalendarDatesMap["daily"] = map[string]int{testServiceDate.Format(serviceDateLayout): 1}
+	RouteTripsMap["r1"] = []string{"marked", "unmarked"}
+	t.Cleanup(func() {
+		delete(CalendarDatesMap, "daily")
+		delete(RouteTripsMap, "r1")
+	})
+
+	timetable := buildTimetable(processing.Route{RouteID: "r1"}, 0, testServiceDate)
+	if len(timetable.Trips) != 2 {
+		t.Fatalf("got %d trips, want 2", len(timetable.Trips))
+	}
+	if len(timetable.Stops) != 3 {
+		t.Errorf("got %d stops, want all 3 of the trip without timepoints", len(timetable.Stops))
+	}
+	for _, row := range timetable.Trips {
+		if row.TripID == "unmarked" && row.Times[1] == "" {
+			t.Errorf("trip without timepoints has no time at s2: %v", row.Times)
+		}
+	}
+}
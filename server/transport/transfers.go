@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// The feed has no transfers.txt, so walking links between stops are
+// generated from straight-line distance. The estimate stretches the distance
+// by a circuity factor for the street network and divides by walking speed.
+
+type walkingConfig struct {
+	maxTransferDistance float64 // meters
+	speed               float64 // meters per second
+	circuity            float64
+}
+
+var walking = walkingConfig{
+	maxTransferDistance: 250,
+	speed:               1.33,
+	circuity:            1.3,
+}
+
+// TransfersMap is the walking transfer graph, from_stop_id -> transfers
+// ordered by walking time.
+var TransfersMap = make(map[string][]processing.Transfer)
+
+// WalkingTimeProvider, when set, replaces the estimate for a pair of stops
+// with a more precise walking time, such as one from a routing service.
+// Returning ok false falls back to the estimate.
+var WalkingTimeProvider func(from, to processing.Stop, distance float64) (seconds int, ok bool)
+
+// LoadWalkingConfig reads TRANSFER_MAX_DISTANCE (meters), WALK_SPEED
+// (meters per second) and WALK_CIRCUITY, keeping the defaults for any that
+// are unset or invalid.
+func LoadWalkingConfig() {
+	readPositive := func(name string, target *float64) {
+		value := os.Getenv(name)
+		if value == "" {
+			return
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			fmt.Printf("Ignoring %s=%q, expected a positive number\n", name, value)
+			return
+		}
+		*target = parsed
+	}
+	readPositive("TRANSFER_MAX_DISTANCE", &walking.maxTransferDistance)
+	readPositive("WALK_SPEED", &walking.speed)
+	readPositive("WALK_CIRCUITY", &walking.circuity)
+	if walking.circuity < 1 {
+		walking.circuity = 1
+	}
+}
+
+// walkSeconds estimates the time to walk a straight-line distance.
+func walkSeconds(distance float64) int {
+	return int(math.Ceil(distance * walking.circuity / walking.speed))
+}
+
+// walkableDistance is the straight-line distance covered in the given time.
+func walkableDistance(seconds int) float64 {
+	return float64(seconds) * walking.speed / walking.circuity
+}
+
+// InitTransfers links every boarding stop to the others within the
+// configured distance. It needs the stops and StopsIndex to be loaded.
+func InitTransfers() {
+	transfers := make(map[string][]processing.Transfer)
+	count, provided := 0, 0
+
+	for _, from := range StopsMap {
+		if from.LocationType != 0 {
+			continue
+		}
+		for _, p := range StopsIndex.nearby(from.StopLat, from.StopLon, walking.maxTransferDistance) {
+			to, ok := findStopById(p.id)
+			if !ok || to.StopID == from.StopID || to.LocationType != 0 {
+				continue
+			}
+
+			distance := haversineMeters(from.StopLat, from.StopLon, to.StopLat, to.StopLon)
+			transfer := processing.Transfer{
+				FromStopID:  from.StopID,
+				ToStopID:    to.StopID,
+				ToStopName:  to.StopName,
+				Distance:    distance,
+				WalkingTime: walkSeconds(distance),
+				Estimated:   true,
+			}
+			if WalkingTimeProvider != nil {
+				if seconds, ok := WalkingTimeProvider(from, to, distance); ok {
+					transfer.WalkingTime = seconds
+					transfer.Estimated = false
+					provided++
+				}
+			}
+			transfers[from.StopID] = append(transfers[from.StopID], transfer)
+			count++
+		}
+	}
+
+	for _, list := range transfers {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].WalkingTime != list[j].WalkingTime {
+				return list[i].WalkingTime < list[j].WalkingTime
+			}
+			return list[i].ToStopID < list[j].ToStopID
+		})
+	}
+
+	TransfersMap = transfers
+	fmt.Printf("TransfersMap initialized with %d walking transfers from %d stops (%d from provider, max %.0fm)\n",
+		count, len(TransfersMap), provided, walking.maxTransferDistance)
+}
+
+func findTransfersByStopID(stopId string) ([]processing.Transfer, bool) {
+	transfers, found := TransfersMap[stopId]
+	return transfers, found
+}
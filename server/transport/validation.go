@@ -0,0 +1,406 @@
+package transport
+
+import (
+	"fmt"
+	"go-octo-eureka/server/processing"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/gin-gonic/gin"
+)
+
+// Every downloaded feed is checked against the loaded static schedule and
+// the latest report per feed is kept for /gtfs/validation, so problems can
+// be reported to the agency with concrete examples.
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+
+	maxValidationExamples = 5
+	// a feed or entity older than this when it was downloaded is stale
+	staleFeedAfter   = 2 * time.Minute
+	staleEntityAfter = 5 * time.Minute
+	// clocks drift, only timestamps further ahead count as future
+	futureTolerance = time.Minute
+)
+
+type validationRule struct {
+	id          string
+	severity    string
+	description string
+}
+
+var (
+	ruleDuplicateEntity   = validationRule{"duplicate_entity_id", severityError, "entity ids must be unique within a feed"}
+	ruleFetchFailed       = validationRule{"fetch_failed", severityError, "the feed could not be downloaded, the rest of the report is from the last download that worked"}
+	ruleUnknownTrip       = validationRule{"unknown_trip", severityError, "trip_id is not in the static schedule"}
+	ruleUnknownRoute      = validationRule{"unknown_route", severityError, "route_id is not in the static schedule"}
+	ruleUnknownStop       = validationRule{"unknown_stop", severityError, "stop_id is not in the static schedule"}
+	ruleRouteMismatch     = validationRule{"route_mismatch", severityError, "route_id differs from the trip's route in the schedule"}
+	ruleInvalidStartDate  = validationRule{"invalid_start_date", severityError, "start_date is not formatted as YYYYMMDD"}
+	ruleInvalidPosition   = validationRule{"invalid_position", severityError, "vehicle position is missing or not a valid coordinate"}
+	ruleSequenceOrder     = validationRule{"stop_sequence_out_of_order", severityError, "stop_time_updates are not sorted by increasing stop_sequence"}
+	ruleUnknownSequence   = validationRule{"unknown_stop_sequence", severityError, "stop_sequence is not part of the trip in the schedule"}
+	ruleStopMismatch      = validationRule{"stop_mismatch", severityError, "stop_id and stop_sequence refer to different stops of the trip"}
+	ruleMissingTimestamp  = validationRule{"missing_timestamp", severityWarning, "the feed header has no timestamp"}
+	ruleStaleFeed         = validationRule{"stale_feed", severityWarning, fmt.Sprintf("the feed header timestamp was more than %s old when downloaded", staleFeedAfter)}
+	ruleStaleEntity       = validationRule{"stale_entity", severityWarning, fmt.Sprintf("the entity timestamp was more than %s old when downloaded", staleEntityAfter)}
+	ruleFutureTimestamp   = validationRule{"future_timestamp", severityWarning, "a timestamp lies in the future"}
+	ruleDirectionMismatch = validationRule{"direction_mismatch", severityWarning, "direction_id differs from the trip's direction in the schedule"}
+	ruleStopNotOnTrip     = validationRule{"stop_not_on_trip", severityWarning, "the vehicle's stop_id is not served by its trip"}
+	ruleDuplicateVehicle  = validationRule{"duplicate_vehicle", severityWarning, "the same vehicle appears in more than one entity"}
+	ruleTimesOutOfOrder   = validationRule{"times_out_of_order", severityWarning, "predicted times go backwards along the trip"}
+)
+
+var validationMu sync.RWMutex
+var validationReports = make(map[string]processing.ValidationReport)
+
+// feedValidator collects the issues of one feed.
+type feedValidator struct {
+	report  processing.ValidationReport
+	issues  map[string]*processing.ValidationIssue
+	fetched time.Time
+}
+
+func (v *feedValidator) add(rule validationRule, example processing.ValidationExample) {
+	issue := v.issues[rule.id]
+	if issue == nil {
+		issue = &processing.ValidationIssue{
+			Rule:        rule.id,
+			Severity:    rule.severity,
+			Description: rule.description,
+			Examples:    []processing.ValidationExample{},
+		}
+		v.issues[rule.id] = issue
+	}
+	issue.Count++
+	if len(issue.Examples) < maxValidationExamples {
+		issue.Examples = append(issue.Examples, example)
+	}
+	if rule.severity == severityError {
+		v.report.Errors++
+	} else {
+		v.report.Warnings++
+	}
+}
+
+// validateFeed checks a downloaded snapshot and replaces the feed's report.
+func validateFeed(feedName string, snapshot *feedSnapshot) {
+	v := &feedValidator{
+		report: processing.ValidationReport{
+			Feed:          archiveName(feedName),
+			CheckedAt:     snapshot.fetchedAt.Unix(),
+			FeedTimestamp: int64(snapshot.feed.GetHeader().GetTimestamp()),
+			Entities:      len(snapshot.feed.Entity),
+		},
+		issues:  make(map[string]*processing.ValidationIssue),
+		fetched: snapshot.fetchedAt,
+	}
+
+	if v.report.FeedTimestamp == 0 {
+		v.add(ruleMissingTimestamp, processing.ValidationExample{Message: "header.timestamp is not set"})
+	} else {
+		v.checkTimestamp(ruleStaleFeed, staleFeedAfter, snapshot.timestamp(), processing.ValidationExample{})
+	}
+
+	seenEntities := make(map[string]bool)
+	seenVehicles := make(map[string]string)
+	for _, entity := range snapshot.feed.Entity {
+		if seenEntities[entity.GetId()] {
+			v.add(ruleDuplicateEntity, processing.ValidationExample{EntityID: entity.GetId(), Message: "entity id used more than once"})
+		}
+		seenEntities[entity.GetId()] = true
+
+		switch {
+		case entity.Vehicle != nil:
+			vehicleID := entity.Vehicle.GetVehicle().GetId()
+			if first, seen := seenVehicles[vehicleID]; seen && vehicleID != "" {
+				v.add(ruleDuplicateVehicle, processing.ValidationExample{EntityID: entity.GetId(), VehicleID: vehicleID, Message: fmt.Sprintf("also in entity %s", first)})
+			} else {
+				seenVehicles[vehicleID] = entity.GetId()
+			}
+			v.checkVehicle(entity.GetId(), entity.Vehicle)
+		case entity.TripUpdate != nil:
+			v.checkTripUpdate(entity.GetId(), entity.TripUpdate)
+		case entity.Alert != nil:
+			v.checkAlert(entity.GetId(), entity.Alert)
+		}
+	}
+
+	v.report.Issues = make([]processing.ValidationIssue, 0, len(v.issues))
+	for _, issue := range v.issues {
+		v.report.Issues = append(v.report.Issues, *issue)
+	}
+	// errors first, then the most frequent
+	sort.Slice(v.report.Issues, func(i, j int) bool {
+		a, b := v.report.Issues[i], v.report.Issues[j]
+		if a.Severity != b.Severity {
+			return a.Severity == severityError
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Rule < b.Rule
+	})
+
+	validationMu.Lock()
+	validationReports[v.report.Feed] = v.report
+	validationMu.Unlock()
+}
+
+// recordFetchFailure adds a failed download to the feed's report, which
+// otherwise keeps describing the last snapshot that was validated. The next
+// successful download replaces the report and clears it.
+func recordFetchFailure(feedName string, err error, at time.Time) {
+	feed := archiveName(feedName)
+	validationMu.Lock()
+	defer validationMu.Unlock()
+
+	report, found := validationReports[feed]
+	if !found {
+		report = processing.ValidationReport{Feed: feed}
+	}
+	failure := processing.ValidationIssue{
+		Rule:        ruleFetchFailed.id,
+		Severity:    ruleFetchFailed.severity,
+		Description: ruleFetchFailed.description,
+	}
+	// the failure goes first, the stored issues are not modified in place
+	issues := make([]processing.ValidationIssue, 1, len(report.Issues)+1)
+	for _, issue := range report.Issues {
+		if issue.Rule == ruleFetchFailed.id {
+			failure.Count = issue.Count
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	failure.Count++
+	failure.Examples = []processing.ValidationExample{{Message: fmt.Sprintf("download at %d failed: %v", at.Unix(), err)}}
+	issues[0] = failure
+	report.Issues = issues
+	report.Errors++
+	validationReports[feed] = report
+}
+
+// checkTimestamp flags a measurement that was too old when downloaded, or
+// that lies in the future.
+func (v *feedValidator) checkTimestamp(stale validationRule, staleAfter time.Duration, ts time.Time, example processing.ValidationExample) {
+	age := v.fetched.Sub(ts)
+	switch {
+	case age > staleAfter:
+		example.Message = fmt.Sprintf("timestamp %d was %s old", ts.Unix(), age.Round(time.Second))
+		v.add(stale, example)
+	case age < -futureTolerance:
+		example.Message = fmt.Sprintf("timestamp %d is %s ahead", ts.Unix(), (-age).Round(time.Second))
+		v.add(ruleFutureTimestamp, example)
+	}
+}
+
+// checkTrip validates a trip descriptor and returns the scheduled trip when
+// it is known.
+func (v *feedValidator) checkTrip(example processing.ValidationExample, trip *gtfs.TripDescriptor) (processing.Trip, bool) {
+	example.TripID, example.RouteID = trip.GetTripId(), trip.GetRouteId()
+
+	if startDate := trip.GetStartDate(); startDate != "" {
+		if _, err := time.Parse(serviceDateLayout, startDate); err != nil {
+			example.Message = fmt.Sprintf("start_date %q", startDate)
+			v.add(ruleInvalidStartDate, example)
+		}
+	}
+
+	if routeID := trip.GetRouteId(); routeID != "" {
+		if _, found := findRouteByID(routeID); !found {
+			example.Message = fmt.Sprintf("route_id %s", routeID)
+			v.add(ruleUnknownRoute, example)
+		}
+	}
+
+	if trip.GetTripId() == "" {
+		return processing.Trip{}, false
+	}
+	static, found := findTripByID(trip.GetTripId())
+	if !found {
+		// added and unscheduled trips are not in the schedule by definition
+		switch trip.GetScheduleRelationship() {
+		case gtfs.TripDescriptor_ADDED, gtfs.TripDescriptor_UNSCHEDULED:
+		default:
+			example.Message = fmt.Sprintf("trip_id %s", trip.GetTripId())
+			v.add(ruleUnknownTrip, example)
+		}
+		return static, false
+	}
+
+	if trip.GetRouteId() != "" && trip.GetRouteId() != static.RouteID {
+		example.Message = fmt.Sprintf("route_id %s, the schedule has %s", trip.GetRouteId(), static.RouteID)
+		v.add(ruleRouteMismatch, example)
+	}
+	if trip.DirectionId != nil && int(trip.GetDirectionId()) != static.DirectionID {
+		example.Message = fmt.Sprintf("direction_id %d, the schedule has %d", trip.GetDirectionId(), static.DirectionID)
+		v.add(ruleDirectionMismatch, example)
+	}
+	return static, true
+}
+
+func (v *feedValidator) checkVehicle(entityID string, vehicle *gtfs.VehiclePosition) {
+	example := processing.ValidationExample{
+		EntityID:  entityID,
+		TripID:    vehicle.GetTrip().GetTripId(),
+		RouteID:   vehicle.GetTrip().GetRouteId(),
+		VehicleID: vehicle.GetVehicle().GetId(),
+	}
+
+	tripKnown := false
+	if vehicle.Trip != nil {
+		_, tripKnown = v.checkTrip(example, vehicle.Trip)
+	}
+
+	position := vehicle.GetPosition()
+	lat, lon := float64(position.GetLatitude()), float64(position.GetLongitude())
+	if position == nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 || (lat == 0 && lon == 0) {
+		example.Message = fmt.Sprintf("position %.6f,%.6f", lat, lon)
+		if position == nil {
+			example.Message = "position is not set"
+		}
+		v.add(ruleInvalidPosition, example)
+	}
+
+	if stopID := vehicle.GetStopId(); stopID != "" {
+		example.StopID = stopID
+		if _, found := findStopById(stopID); !found {
+			example.Message = fmt.Sprintf("stop_id %s", stopID)
+			v.add(ruleUnknownStop, example)
+		} else if tripKnown {
+			if _, onTrip := findStopTimeByTripAndStop(vehicle.GetTrip().GetTripId(), stopID); !onTrip {
+				example.Message = fmt.Sprintf("stop_id %s is not on trip %s", stopID, vehicle.GetTrip().GetTripId())
+				v.add(ruleStopNotOnTrip, example)
+			}
+		}
+		example.StopID = ""
+	}
+
+	if ts := vehicle.GetTimestamp(); ts != 0 {
+		v.checkTimestamp(ruleStaleEntity, staleEntityAfter, time.Unix(int64(ts), 0), example)
+	}
+}
+
+func (v *feedValidator) checkTripUpdate(entityID string, tu *gtfs.TripUpdate) {
+	tripID := tu.GetTrip().GetTripId()
+	example := processing.ValidationExample{
+		EntityID:  entityID,
+		TripID:    tripID,
+		RouteID:   tu.GetTrip().GetRouteId(),
+		VehicleID: tu.GetVehicle().GetId(),
+	}
+	_, tripKnown := v.checkTrip(example, tu.GetTrip())
+	stopTimes, _ := findStopTimesByTripID(tripID)
+
+	lastSequence := -1
+	var lastTime int64
+	for _, stu := range tu.StopTimeUpdate {
+		stopExample := example
+		stopExample.StopID = stu.GetStopId()
+
+		if stopID := stu.GetStopId(); stopID != "" {
+			if _, found := findStopById(stopID); !found {
+				stopExample.Message = fmt.Sprintf("stop_id %s", stopID)
+				v.add(ruleUnknownStop, stopExample)
+			}
+		}
+
+		if tripKnown && stu.StopSequence != nil {
+			sequence := int(stu.GetStopSequence())
+			scheduledStop := ""
+			for _, st := range stopTimes {
+				if st.StopSequence == sequence {
+					scheduledStop = st.StopID
+					break
+				}
+			}
+			switch {
+			case scheduledStop == "":
+				stopExample.Message = fmt.Sprintf("stop_sequence %d", sequence)
+				v.add(ruleUnknownSequence, stopExample)
+			case stu.GetStopId() != "" && stu.GetStopId() != scheduledStop:
+				stopExample.Message = fmt.Sprintf("stop_sequence %d is stop %s in the schedule, not %s", sequence, scheduledStop, stu.GetStopId())
+				v.add(ruleStopMismatch, stopExample)
+			}
+		}
+
+		if sequence := stopTimeUpdateSequence(stopTimes, lastSequence, stu); sequence >= 0 {
+			if sequence <= lastSequence {
+				stopExample.Message = fmt.Sprintf("stop_sequence %d follows %d", sequence, lastSequence)
+				v.add(ruleSequenceOrder, stopExample)
+			}
+			lastSequence = sequence
+		}
+
+		if stu.GetScheduleRelationship() == gtfs.TripUpdate_StopTimeUpdate_SKIPPED ||
+			stu.GetScheduleRelationship() == gtfs.TripUpdate_StopTimeUpdate_NO_DATA {
+			continue
+		}
+		for _, event := range []*gtfs.TripUpdate_StopTimeEvent{stu.GetArrival(), stu.GetDeparture()} {
+			if event == nil || event.Time == nil {
+				continue
+			}
+			if event.GetTime() < lastTime {
+				stopExample.Message = fmt.Sprintf("time %d is before the previous %d", event.GetTime(), lastTime)
+				v.add(ruleTimesOutOfOrder, stopExample)
+			}
+			lastTime = event.GetTime()
+		}
+	}
+
+	if ts := tu.GetTimestamp(); ts != 0 {
+		v.checkTimestamp(ruleStaleEntity, staleEntityAfter, time.Unix(int64(ts), 0), example)
+	}
+}
+
+func (v *feedValidator) checkAlert(entityID string, alert *gtfs.Alert) {
+	for _, informed := range alert.InformedEntity {
+		example := processing.ValidationExample{EntityID: entityID, RouteID: informed.GetRouteId(), StopID: informed.GetStopId()}
+		if routeID := informed.GetRouteId(); routeID != "" {
+			if _, found := findRouteByID(routeID); !found {
+				example.Message = fmt.Sprintf("informed_entity route_id %s", routeID)
+				v.add(ruleUnknownRoute, example)
+			}
+		}
+		if stopID := informed.GetStopId(); stopID != "" {
+			if _, found := findStopById(stopID); !found {
+				example.Message = fmt.Sprintf("informed_entity stop_id %s", stopID)
+				v.add(ruleUnknownStop, example)
+			}
+		}
+		if informed.Trip != nil {
+			v.checkTrip(example, informed.Trip)
+		}
+	}
+}
+
+// GET /validation?feed=alerts|tripupdates|vehiclepositions
+// The latest report of each feed, or of one.
+func HandleValidation(c *gin.Context) {
+	validationMu.RLock()
+	defer validationMu.RUnlock()
+
+	if feed := c.Query("feed"); feed != "" {
+		report, found := validationReports[feed]
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No validation report for feed %s", feed)})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	reports := make([]processing.ValidationReport, 0, len(validationReports))
+	for _, poller := range feedPollers {
+		if report, found := validationReports[archiveName(poller.name)]; found {
+			reports = append(reports, report)
+		}
+	}
+	c.JSON(http.StatusOK, reports)
+}
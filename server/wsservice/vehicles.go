@@ -0,0 +1,176 @@
+package wsservice
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients opt in to live vehicle positions by sending
+//
+//	{"event": "SUBSCRIBE_VEHICLES", "data": "0,15,AB"}
+//
+// with a comma separated list of route IDs, or "*" (or nothing) for every
+// route. UNSUBSCRIBE_VEHICLES takes the same list, or nothing to stop
+// entirely. Each new feed is then pushed as a VEHICLE_POSITIONS event whose
+// data is a JSON VehicleUpdate holding only the subscribed routes.
+
+const (
+	EventSubscribeVehicles   = "SUBSCRIBE_VEHICLES"
+	EventUnsubscribeVehicles = "UNSUBSCRIBE_VEHICLES"
+	EventSubscribed          = "SUBSCRIBED"
+	EventVehiclePositions    = "VEHICLE_POSITIONS"
+)
+
+type VehicleUpdate struct {
+	Timestamp int64         `json:"timestamp"` // feed header time, unix seconds
+	Vehicles  []interface{} `json:"vehicles"`
+}
+
+type vehicleSubscription struct {
+	all    bool
+	routes map[string]bool
+}
+
+var (
+	subscriptions = make(map[*websocket.Conn]*vehicleSubscription) // guarded by clientMux
+	latestMux     sync.Mutex
+	latestRoutes  map[string][]interface{}
+	latestTime    int64
+	// signals handleVehicleUpdates, updates arriving meanwhile coalesce
+	vehiclesPending = make(chan struct{}, 1)
+)
+
+// PublishVehicles hands a new set of vehicles, grouped by route ID, to the
+// background fan-out and returns at once, so slow clients never hold up
+// the caller.
+func PublishVehicles(timestamp int64, byRoute map[string][]interface{}) {
+	latestMux.Lock()
+	latestRoutes, latestTime = byRoute, timestamp
+	latestMux.Unlock()
+
+	select {
+	case vehiclesPending <- struct{}{}:
+	default:
+	}
+}
+
+// handleVehicleUpdates runs in the background and queues the latest
+// vehicles for every subscribed client.
+func handleVehicleUpdates() {
+	for range vehiclesPending {
+		latestMux.Lock()
+		byRoute, timestamp := latestRoutes, latestTime
+		latestMux.Unlock()
+
+		clientMux.Lock()
+		for client, sub := range subscriptions {
+			if err := sendVehicles(client, sub, timestamp, byRoute); err != nil {
+				log.Printf("Websocket error: %s", err)
+			}
+		}
+		clientMux.Unlock()
+	}
+}
+
+// sendVehicles queues one client's share of an update. clientMux must be
+// held.
+func sendVehicles(client *websocket.Conn, sub *vehicleSubscription, timestamp int64, byRoute map[string][]interface{}) error {
+	update := VehicleUpdate{Timestamp: timestamp, Vehicles: []interface{}{}}
+	for routeID, vehicles := range byRoute {
+		if sub.all || sub.routes[routeID] {
+			update.Vehicles = append(update.Vehicles, vehicles...)
+		}
+	}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	queueEvent(client, WSEvent{Event: EventVehiclePositions, Data: string(data), Sender: "server"})
+	return nil
+}
+
+// handleSubscription applies a (un)subscribe request from a client and
+// reports whether the event was one. A new subscriber is sent the latest
+// vehicles straight away rather than waiting for the next feed.
+func handleSubscription(ws *websocket.Conn, event WSEvent) bool {
+	if event.Event != EventSubscribeVehicles && event.Event != EventUnsubscribeVehicles {
+		return false
+	}
+
+	var routeIDs []string
+	for _, routeID := range strings.Split(event.Data, ",") {
+		if routeID = strings.TrimSpace(routeID); routeID != "" {
+			routeIDs = append(routeIDs, routeID)
+		}
+	}
+
+	clientMux.Lock()
+	defer clientMux.Unlock()
+
+	sub := subscriptions[ws]
+	if event.Event == EventSubscribeVehicles {
+		if sub == nil {
+			sub = &vehicleSubscription{routes: make(map[string]bool)}
+			subscriptions[ws] = sub
+		}
+		if len(routeIDs) == 0 || (len(routeIDs) == 1 && routeIDs[0] == "*") {
+			sub.all = true
+		}
+		for _, routeID := range routeIDs {
+			if routeID != "*" {
+				sub.routes[routeID] = true
+			}
+		}
+	} else if sub != nil {
+		if len(routeIDs) == 0 {
+			delete(subscriptions, ws)
+			sub = nil
+		}
+		for _, routeID := range routeIDs {
+			if routeID == "*" {
+				sub.all = false
+			} else {
+				delete(sub.routes, routeID)
+			}
+		}
+		if sub != nil && !sub.all && len(sub.routes) == 0 {
+			delete(subscriptions, ws)
+			sub = nil
+		}
+	}
+
+	queueEvent(ws, WSEvent{Event: EventSubscribed, Data: describeSubscription(sub), Sender: "server"})
+
+	if sub != nil && event.Event == EventSubscribeVehicles {
+		latestMux.Lock()
+		byRoute, timestamp := latestRoutes, latestTime
+		latestMux.Unlock()
+		if byRoute != nil {
+			sendVehicles(ws, sub, timestamp, byRoute)
+		}
+	}
+	return true
+}
+
+// describeSubscription lists the subscribed routes, "*" for all of them
+// and an empty string for none.
+func describeSubscription(sub *vehicleSubscription) string {
+	if sub == nil {
+		return ""
+	}
+	if sub.all {
+		return "*"
+	}
+	routeIDs := make([]string, 0, len(sub.routes))
+	for routeID := range sub.routes {
+		routeIDs = append(routeIDs, routeID)
+	}
+	sort.Strings(routeIDs)
+	return strings.Join(routeIDs, ",")
+}
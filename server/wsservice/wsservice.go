@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -15,6 +16,14 @@ type WSEvent struct {
 	Sender string `json:"sender"`
 }
 
+const (
+	// clientSendBuffer events may queue for a client, further events are
+	// dropped until it catches up
+	clientSendBuffer = 32
+	// a client that takes longer than this to accept a write is dropped
+	writeTimeout = 10 * time.Second
+)
+
 var (
 	OnAnnouncement func(sender string, data string)
 	OnConnect      func(sender string, data string)
@@ -22,13 +31,14 @@ var (
 	upgrader       = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
-	clients   = make(map[*websocket.Conn]bool)
-	clientMux sync.Mutex // protects the clients map
+	clients   = make(map[*websocket.Conn]chan WSEvent) // client -> its outgoing queue
+	clientMux sync.Mutex                               // protects the clients map
 	broadcast = make(chan WSEvent)
 )
 
 func Init() {
 	go handleBroadcastQueue()
+	go handleVehicleUpdates()
 }
 
 func WebSocketRoutes(r *gin.Engine) {
@@ -39,16 +49,17 @@ func WebSocketRoutes(r *gin.Engine) {
 			return
 		}
 
-		// Register new client safely
+		// Register new client safely, its writer is the only goroutine that
+		// writes to the connection
+		send := make(chan WSEvent, clientSendBuffer)
 		clientMux.Lock()
-		clients[ws] = true
+		clients[ws] = send
+		queueEvent(ws, WSEvent{Event: "connected", Data: "Welcome to the server", Sender: "YourServer"})
 		clientMux.Unlock()
 
 		log.Println("Peer connected to our WS Server")
 
-		// Ack client connection
-		ws.WriteJSON(WSEvent{Event: "connected", Data: "Welcome to the server", Sender: "YourServer"})
-
+		go writeClientMessages(ws, send)
 		go readClientMessages(ws)
 	})
 	log.Println("ROUTE: GET /ws")
@@ -65,7 +76,9 @@ func WebSocketRoutes(r *gin.Engine) {
 func readClientMessages(ws *websocket.Conn) {
 	defer func() {
 		clientMux.Lock()
+		close(clients[ws])
 		delete(clients, ws)
+		delete(subscriptions, ws)
 		clientMux.Unlock()
 		ws.Close()
 		log.Println("Client disconnected")
@@ -80,10 +93,40 @@ func readClientMessages(ws *websocket.Conn) {
 		if err := ws.ReadJSON(&msg); err != nil {
 			break // trigger defer
 		}
+		if handleSubscription(ws, msg) {
+			continue
+		}
 		HandleIncomingEvent(msg)
 	}
 }
 
+// writeClientMessages sends a client's queued events. A failed or timed out
+// write closes the connection, which ends readClientMessages and with it
+// the client's registration.
+func writeClientMessages(ws *websocket.Conn, send <-chan WSEvent) {
+	for event := range send {
+		ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := ws.WriteJSON(event); err != nil {
+			log.Printf("Websocket error: %s", err)
+			ws.Close()
+			for range send {
+				// discard until readClientMessages closes the queue
+			}
+			return
+		}
+	}
+}
+
+// queueEvent hands an event to a client's writer without blocking, a
+// client whose queue is full misses it. clientMux must be held.
+func queueEvent(ws *websocket.Conn, event WSEvent) {
+	select {
+	case clients[ws] <- event:
+	default:
+		log.Printf("Websocket client too slow, dropped %s event", event.Event)
+	}
+}
+
 // SendMessage queues a message to be sent to all clients
 func SendMessage(event WSEvent) {
 	broadcast <- event
@@ -96,12 +139,7 @@ func handleBroadcastQueue() {
 
 		clientMux.Lock()
 		for client := range clients {
-			err := client.WriteJSON(event)
-			if err != nil {
-				log.Printf("Websocket error: %s", err)
-				client.Close()
-				delete(clients, client)
-			}
+			queueEvent(client, event)
 		}
 		clientMux.Unlock()
 	}